@@ -1,6 +1,7 @@
 package changelog
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"sort"
@@ -15,15 +16,110 @@ type Data struct {
 	date    time.Time
 	version version.Version
 	entries []entry
+	// sections holds the section titles, indexed by entry.section. Nil if
+	// the entries are not grouped into sections.
+	sections []string
+	warnings []string
+	// raw holds the text of a section parsed from a ChangeLog file that has
+	// not been split into entries, including the empty lines following it.
+	// FileFormat returns it unchanged.
+	raw string
 }
 
+// Policy controls how pull requests are turned into ChangeLog entries.
+type Policy struct {
+	// Categories maps label names to ChangeLog categories.
+	Categories map[string]string
+	// Order lists the categories sorted to the front of the ChangeLog.
+	// Entries in these categories are sorted by category, then by PR number.
+	// All other entries follow, sorted alphabetically.
+	Order []string
+	// ScopeCategories uses the scope of Conventional Commits titles, e.g.
+	// "cpu" in "feat(cpu): ...", as category of entries without a category
+	// label.
+	ScopeCategories bool
+	// Sections lists the titled sections of the ChangeLog, in order. Empty
+	// sections are omitted. If Sections is empty, entries are not grouped.
+	Sections []Section
+	// Kinds lists categories that order the entries of each plugin within
+	// their section, e.g. features before fixes, without selecting the
+	// section. Entries without one of these categories follow.
+	Kinds []string
+	// Prefixes maps the prefix of entry texts, e.g. "Build system" in
+	// "Build system: Text.", to the category of the entry. It takes
+	// precedence over the categories of labels.
+	Prefixes map[string]string
+	// Plugins lists the known plugin names. Plugin names in entries, e.g.
+	// "write_prometheus plugin: ...", are spelled as in this list. Entries
+	// naming other plugins cause a warning. If empty, plugin names are used
+	// as written.
+	Plugins []string
+}
+
+// Section is a titled group of ChangeLog entries.
+type Section struct {
+	Title string
+	// Categories lists the categories of the entries in this section. A
+	// section without categories holds all entries not in any other section.
+	Categories []string
+}
+
+// otherTitle is the title of the section holding entries not in any section,
+// if the policy has no section without categories.
+const otherTitle = "Other changes"
+
+// DefaultPolicy groups entries into breaking changes, new features, bug fixes,
+// core, plugin and build system changes. Entries starting with "collectd:" or
+// "Build system:" are listed under core or build system changes regardless of
+// their labels. PRs labeled "core" are sorted by number.
+var DefaultPolicy = Policy{
+	Categories: map[string]string{
+		"Breaking": "breaking",
+		"Feature":  "features",
+		"Fix":      "fixes",
+		"core":     "core",
+	},
+	Order: []string{"core"},
+	Sections: []Section{
+		{Title: "Breaking changes", Categories: []string{"breaking"}},
+		{Title: "New features", Categories: []string{"features"}},
+		{Title: "Bug fixes", Categories: []string{"fixes"}},
+		{Title: "Core", Categories: []string{"core"}},
+		{Title: "Plugins"},
+		{Title: "Build/Packaging", Categories: []string{"build"}},
+	},
+	Prefixes: map[string]string{
+		"Build system": "build",
+		"collectd":     "core",
+	},
+	Plugins: KnownPlugins,
+}
+
+// New creates the ChangeLog data using DefaultPolicy.
 func New(date time.Time, version version.Version, prs []*github.PullRequest) Data {
+	return DefaultPolicy.New(date, version, prs)
+}
+
+// New creates the ChangeLog data for version from the "ChangeLog:" lines and
+// blocks of prs.
+func (p Policy) New(date time.Time, version version.Version, prs []*github.PullRequest) Data {
 	cl := Data{
 		date:    date,
 		version: version,
 	}
+	if len(p.Sections) != 0 {
+		for _, s := range p.Sections {
+			cl.sections = append(cl.sections, s.Title)
+		}
+		if p.catchAll() == len(p.Sections) {
+			cl.sections = append(cl.sections, otherTitle)
+		}
+	}
 	for _, pr := range prs {
-		if e, ok := parseEntry(pr); ok {
+		for _, e := range p.parseEntries(pr) {
+			if _, known := p.plugin(e.plugin); e.plugin != "" && !known && len(p.Plugins) != 0 {
+				cl.warnings = append(cl.warnings, fmt.Sprintf("unknown plugin %q in the ChangeLog entry of #%d", e.plugin, e.prID))
+			}
 			cl.entries = append(cl.entries, e)
 		}
 	}
@@ -32,15 +128,74 @@ func New(date time.Time, version version.Version, prs []*github.PullRequest) Dat
 	return cl
 }
 
+// Date returns the release date.
+func (cl Data) Date() time.Time {
+	return cl.date
+}
+
+// Version returns the released version.
+func (cl Data) Version() version.Version {
+	return cl.version
+}
+
+// Warnings returns the problems found in the ChangeLog entries, e.g. unknown
+// plugin names.
+func (cl Data) Warnings() []string {
+	return cl.warnings
+}
+
+// MarshalJSON implements json.Marshaler.
+func (cl Data) MarshalJSON() ([]byte, error) {
+	type jsonEntry struct {
+		Text     string `json:"text"`
+		Author   string `json:"author"`
+		PR       int    `json:"pr"`
+		Category string `json:"category,omitempty"`
+		Section  string `json:"section,omitempty"`
+		Plugin   string `json:"plugin,omitempty"`
+	}
+	v := struct {
+		Date    string      `json:"date"`
+		Version string      `json:"version"`
+		Entries []jsonEntry `json:"entries"`
+	}{
+		Date:    cl.date.Format("2006-01-02"),
+		Version: cl.version.String(),
+		Entries: []jsonEntry{},
+	}
+	for _, e := range cl.entries {
+		v.Entries = append(v.Entries, jsonEntry{
+			Text:     e.text,
+			Author:   e.author,
+			PR:       e.prID,
+			Category: e.category,
+			Section:  cl.title(e),
+			Plugin:   e.plugin,
+		})
+	}
+	return json.Marshal(v)
+}
+
 func (cl Data) Len() int {
 	return len(cl.entries)
 }
 
 func (cl Data) Less(i, j int) bool {
-	if cl.entries[i].isCore != cl.entries[j].isCore {
-		return cl.entries[i].isCore
+	if cl.entries[i].section != cl.entries[j].section {
+		return cl.entries[i].section < cl.entries[j].section
 	}
-	if cl.entries[i].isCore {
+	if cl.entries[i].rank != cl.entries[j].rank {
+		return cl.entries[i].rank < cl.entries[j].rank
+	}
+	// Entries for the same plugin are kept together, so that they can be
+	// listed below a common bullet. Entries without a plugin come first.
+	if cl.entries[i].plugin != cl.entries[j].plugin {
+		return cl.entries[i].plugin < cl.entries[j].plugin
+	}
+	if cl.entries[i].kind != cl.entries[j].kind {
+		return cl.entries[i].kind < cl.entries[j].kind
+	}
+	if cl.entries[i].ordered {
 		return cl.entries[i].prID < cl.entries[j].prID
 	}
 	return cl.entries[i].text < cl.entries[j].text
@@ -56,76 +211,398 @@ func (cl Data) String() string {
 
 func (cl Data) Markdown() string {
 	var b strings.Builder
-	for _, e := range cl.entries {
-		fmt.Fprintln(&b, "*  ", e)
+	for i, e := range cl.entries {
+		if cl.startsSection(i) {
+			if i != 0 {
+				fmt.Fprintln(&b)
+			}
+			fmt.Fprintf(&b, "### %s\n\n", cl.title(e))
+		}
+		grouped, first := cl.grouped(i)
+		switch {
+		case first:
+			fmt.Fprintf(&b, "*   %s plugin:\n", e.plugin)
+			fallthrough
+		case grouped:
+			fmt.Fprintln(&b, "    *  ", e.pluginString())
+		default:
+			fmt.Fprintln(&b, "*  ", e)
+		}
 	}
 
 	return b.String()
 }
 
 func (cl Data) FileFormat() string {
+	if cl.raw != "" {
+		return cl.raw
+	}
+
 	var b strings.Builder
-	fmt.Fprintf(&b, "%s, Version %s\n", cl.date.Format("2006-01-02"), cl.version)
-	for _, e := range cl.entries {
-		fmt.Fprint(&b, e.FileFormat())
+	fmt.Fprintln(&b, Header(cl.date, cl.version))
+	for i, e := range cl.entries {
+		if cl.startsSection(i) {
+			fmt.Fprintf(&b, "\t%s:\n", cl.title(e))
+		}
+		grouped, first := cl.grouped(i)
+		switch {
+		case first:
+			fmt.Fprintf(&b, "\t* %s plugin:\n", e.plugin)
+			fallthrough
+		case grouped:
+			fmt.Fprint(&b, e.pluginFileFormat())
+		default:
+			fmt.Fprint(&b, e.FileFormat())
+		}
 	}
 
 	return b.String()
 }
 
+// startsSection returns true if the i-th entry is the first entry of a
+// titled section.
+func (cl Data) startsSection(i int) bool {
+	if cl.sections == nil {
+		return false
+	}
+	return i == 0 || cl.entries[i-1].section != cl.entries[i].section
+}
+
+// grouped returns whether the i-th entry is listed under a common bullet with
+// neighboring entries for the same plugin, and whether it is the first entry
+// of that group.
+func (cl Data) grouped(i int) (grouped, first bool) {
+	if g := cl.entries[i].group; g != 0 {
+		return g > 0, g > 0 && (i == 0 || cl.entries[i-1].group != g)
+	}
+	samePrev := i > 0 && cl.entries[i-1].samePlugin(cl.entries[i])
+	sameNext := i+1 < len(cl.entries) && cl.entries[i+1].samePlugin(cl.entries[i])
+	return samePrev || sameNext, !samePrev && sameNext
+}
+
+// title returns the title of the section of e, or the empty string if the
+// entries are not grouped into sections.
+func (cl Data) title(e entry) string {
+	if cl.sections == nil {
+		return ""
+	}
+	return cl.sections[e.section]
+}
+
+// Header returns the first line of a ChangeLog file section, e.g.
+// "2024-01-26, Version 6.0.1".
+func Header(date time.Time, v version.Version) string {
+	return fmt.Sprintf("%s, Version %s", date.Format("2006-01-02"), v)
+}
+
 type entry struct {
-	text   string
-	author string
-	prID   int
-	isCore bool
+	text     string
+	author   string
+	prID     int
+	category string
+	// section is the index of the entry's section in Data.sections.
+	section int
+	// plugin is the name of the plugin the entry is about, if any. text
+	// starts with "<plugin> plugin: " in that case.
+	plugin string
+	// group identifies the plugin group of entries parsed from a ChangeLog
+	// file. Entries with the same positive group are listed below a common
+	// bullet, entries with a negative group are listed on their own. If zero,
+	// neighboring entries for the same plugin are grouped.
+	group int
+	// raw holds the lines the entry was parsed from, if any. They are used
+	// by FileFormat, so that parsed ChangeLog files are reproduced exactly.
+	raw string
+	// rank is the position of category in Policy.Order, or len(Policy.Order)
+	// if the category is not ordered.
+	rank    int
+	ordered bool
+	// kind is the position of the entry's first category in Policy.Kinds,
+	// or len(Policy.Kinds).
+	kind int
 }
 
-var changeLogRE = regexp.MustCompile(`(?m)^ChangeLog: (.*)`)
+var (
+	// changeLogRE matches "ChangeLog:" lines, optionally with a category,
+	// e.g. "ChangeLog(fix): Text.".
+	changeLogRE = regexp.MustCompile(`(?m)^ChangeLog(?:\(([\w-]+)\))?: *(.*)$`)
+	// changeLogBlockRE matches fenced code blocks with the info string
+	// "ChangeLog", optionally with a category.
+	changeLogBlockRE = regexp.MustCompile("(?ms)^```ChangeLog(?:\\(([\\w-]+)\\))?[ \t]*$(.*?)^```[ \t]*$")
+)
 
-func parseEntry(pr *github.PullRequest) (entry, bool) {
-	m := changeLogRE.FindStringSubmatch(pr.GetBody())
-	if len(m) < 2 {
-		return entry{}, false
+// entryText is the text of a ChangeLog entry as found in a pull request
+// description.
+type entryText struct {
+	// category overrides the category of the pull request, if not empty.
+	category string
+	text     string
+}
+
+// parseBody returns the ChangeLog entries in the pull request description
+// body. Entries are either given by "ChangeLog:" lines, or by the paragraphs
+// of a fenced code block:
+//
+//	```ChangeLog
+//	First entry, which spans
+//	multiple lines.
+//
+//	Second entry.
+//	```
+//
+// A category may be given in parentheses, e.g. "ChangeLog(fix): Text.". none
+// is true if the description opts out of a ChangeLog entry with "ChangeLog:
+// none".
+func parseBody(body string) (texts []entryText, none bool) {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+
+	for _, m := range changeLogBlockRE.FindAllStringSubmatch(body, -1) {
+		for _, para := range strings.Split(m[2], "\n\n") {
+			if text := strings.Join(strings.Fields(para), " "); text != "" {
+				texts = append(texts, entryText{category: m[1], text: text})
+			}
+		}
+	}
+	body = changeLogBlockRE.ReplaceAllString(body, "")
+
+	for _, m := range changeLogRE.FindAllStringSubmatch(body, -1) {
+		text := strings.TrimSpace(m[2])
+		if strings.EqualFold(strings.TrimSuffix(text, "."), "none") {
+			none = true
+			continue
+		}
+		if text != "" {
+			texts = append(texts, entryText{category: m[1], text: text})
+		}
 	}
 
-	text := strings.TrimSpace(m[1])
+	return texts, none
+}
+
+// Missing returns true if the description of pr has neither a ChangeLog entry
+// nor opts out with "ChangeLog: none".
+func Missing(pr *github.PullRequest) bool {
+	texts, none := parseBody(pr.GetBody())
+	return len(texts) == 0 && !none
+}
+
+// parseEntries returns the ChangeLog entries of pr.
+func (p Policy) parseEntries(pr *github.PullRequest) []entry {
+	texts, _ := parseBody(pr.GetBody())
+	if len(texts) == 0 {
+		return nil
+	}
+
+	base := entry{
+		author:  pr.GetUser().GetLogin(),
+		prID:    pr.GetNumber(),
+		section: p.catchAll(),
+		rank:    len(p.Order),
+		kind:    len(p.Kinds),
+	}
+	// Categories listed in a section take precedence over the section
+	// without categories, regardless of the order of the sections.
+	bestKey := 0
+	for _, l := range pr.Labels {
+		category, ok := p.Categories[l.GetName()]
+		if !ok {
+			continue
+		}
+		if kind := p.kind(category); kind < len(p.Kinds) {
+			base.kind = min(base.kind, kind)
+			continue
+		}
+		key, rank := p.sectionKey(category), p.rank(category)
+		if base.category == "" || key < bestKey || (key == bestKey && rank < base.rank) {
+			base.setCategory(p, category)
+			bestKey = key
+		}
+	}
+	if base.category == "" && p.ScopeCategories {
+		if c, ok := version.ParseConventional(pr.GetTitle(), pr.GetBody()); ok && c.Scope != "" {
+			base.setCategory(p, c.Scope)
+		}
+	}
+
+	var labelPlugin string
+	for _, l := range pr.Labels {
+		if m := pluginLabelRE.FindStringSubmatch(l.GetName()); m != nil {
+			labelPlugin = m[1]
+			break
+		}
+	}
+
+	var ret []entry
+	for _, t := range texts {
+		e := base
+		e.text, e.plugin = p.parseText(t.text, labelPlugin)
+		if prefix, _, ok := strings.Cut(e.text, ": "); ok && p.Prefixes[prefix] != "" {
+			e.override(p, p.Prefixes[prefix])
+		}
+		if t.category != "" {
+			e.override(p, p.category(t.category))
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// parseText returns the text of an entry and the plugin it is about. The
+// plugin is taken from a "<plugin> plugin: " prefix of text, or defaults to
+// labelPlugin.
+func (p Policy) parseText(text, labelPlugin string) (string, string) {
 	if !strings.HasSuffix(text, ".") {
 		text = text + "."
 	}
 
-	return entry{
-		text:   text,
-		author: pr.GetUser().GetLogin(),
-		prID:   pr.GetNumber(),
-		isCore: hasLabel(pr, "core"),
-	}, true
+	plugin := labelPlugin
+	if m := pluginRE.FindStringSubmatch(text); m != nil {
+		plugin, text = m[1], m[2]
+	}
+	if plugin == "" {
+		return text, ""
+	}
+
+	plugin, _ = p.plugin(plugin)
+	return plugin + " plugin: " + text, plugin
 }
 
-func hasLabel(pr *github.PullRequest, name string) bool {
-	for _, l := range pr.Labels {
-		if l.GetName() == name {
-			return true
+// override sets the kind of e if category is one of Policy.Kinds, and the
+// category of e otherwise.
+func (e *entry) override(p Policy, category string) {
+	if kind := p.kind(category); kind < len(p.Kinds) {
+		e.kind = kind
+		return
+	}
+	e.setCategory(p, category)
+}
+
+// setCategory sets the category of e and the derived section and rank.
+func (e *entry) setCategory(p Policy, category string) {
+	e.category = category
+	e.section = p.section(category)
+	e.rank = p.rank(category)
+	e.ordered = e.rank < len(p.Order)
+}
+
+// category returns the category named in a "ChangeLog(<name>):" line. name is
+// either the name of a label, ignoring case, or a category.
+func (p Policy) category(name string) string {
+	for label, category := range p.Categories {
+		if strings.EqualFold(label, name) {
+			return category
 		}
 	}
-	return false
+	return name
+}
+
+func (p Policy) rank(category string) int {
+	for i, c := range p.Order {
+		if c == category {
+			return i
+		}
+	}
+	return len(p.Order)
+}
+
+// kind returns the position of category in p.Kinds, or len(p.Kinds).
+func (p Policy) kind(category string) int {
+	for i, c := range p.Kinds {
+		if c == category {
+			return i
+		}
+	}
+	return len(p.Kinds)
+}
+
+// sectionKey returns the index of the section listing category, or
+// len(p.Sections) if no section lists it.
+func (p Policy) sectionKey(category string) int {
+	for i, s := range p.Sections {
+		for _, c := range s.Categories {
+			if c == category {
+				return i
+			}
+		}
+	}
+	return len(p.Sections)
+}
+
+// section returns the index of the section holding entries in category. If
+// no section lists category, it returns the index of the section without
+// categories, or len(p.Sections) if there is none. If the policy has no
+// sections, it returns zero.
+func (p Policy) section(category string) int {
+	for i, s := range p.Sections {
+		for _, c := range s.Categories {
+			if c == category {
+				return i
+			}
+		}
+	}
+	return p.catchAll()
+}
+
+// catchAll returns the index of the first section without categories, or
+// len(p.Sections) if there is none.
+func (p Policy) catchAll() int {
+	for i, s := range p.Sections {
+		if len(s.Categories) == 0 {
+			return i
+		}
+	}
+	return len(p.Sections)
 }
 
 func (e entry) String() string {
+	if e.author == "" && e.prID == 0 {
+		return e.text
+	}
 	return fmt.Sprintf("%s Thanks to @%s. #%d", e.text, e.author, e.prID)
 }
 
+// pluginString returns the entry without the "<plugin> plugin: " prefix, for
+// listing it below a common bullet for the plugin.
+func (e entry) pluginString() string {
+	return strings.TrimPrefix(e.String(), e.plugin+" plugin: ")
+}
+
+// samePlugin returns true if e and o are about the same plugin and in the
+// same section.
+func (e entry) samePlugin(o entry) bool {
+	return e.plugin != "" && e.plugin == o.plugin && e.section == o.section
+}
+
+// pluginFileFormat formats the entry for listing it below a common bullet
+// for the plugin.
+func (e entry) pluginFileFormat() string {
+	if e.raw != "" {
+		return e.raw
+	}
+	return wrap("\t  -", "\t   ", e.pluginString())
+}
+
 func (e entry) FileFormat() string {
+	if e.raw != "" {
+		return e.raw
+	}
+	return wrap("\t*", "\t ", e.String())
+}
+
+// wrap formats text as a bullet point starting with bullet, wrapped at 80
+// columns. Continuation lines start with indent.
+func wrap(bullet, indent, text string) string {
 	const textWidth = 80
 	var b strings.Builder
 
-	fmt.Fprint(&b, "\t*")
-	col := 9
+	fmt.Fprint(&b, bullet)
+	col := width(bullet)
 
-	words := strings.Split(e.String(), " ")
+	words := strings.Split(text, " ")
 	for _, word := range words {
 		if col+1+len(word) > textWidth {
-			fmt.Fprint(&b, "\n\t ")
-			col = 9
+			fmt.Fprint(&b, "\n", indent)
+			col = width(indent)
 		}
 		fmt.Fprint(&b, " ", word)
 		col += 1 + len(word)
@@ -134,3 +611,17 @@ func (e entry) FileFormat() string {
 	fmt.Fprint(&b, "\n")
 	return b.String()
 }
+
+// width returns the number of columns s occupies, with tab stops every eight
+// columns.
+func width(s string) int {
+	var col int
+	for _, r := range s {
+		if r == '\t' {
+			col += 8 - col%8
+			continue
+		}
+		col++
+	}
+	return col
+}
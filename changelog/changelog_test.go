@@ -10,6 +10,7 @@ import (
 )
 
 type pr struct {
+	title  string
 	body   string
 	author string
 	number int
@@ -18,7 +19,8 @@ type pr struct {
 
 func (pr pr) toGithub() *github.PullRequest {
 	ret := github.PullRequest{
-		Body: github.String(pr.body),
+		Title: github.String(pr.title),
+		Body:  github.String(pr.body),
 		User: &github.User{
 			Login: github.String(pr.author),
 		},
@@ -74,8 +76,10 @@ ChangeLog: Build system: the '--enable-compatibility-mode' has been added to con
 					labels: []string{"core", "Feature"},
 				},
 			},
-			wantMarkdown: `*   Build system: the '--enable-compatibility-mode' has been added to control whether or not to build plugins using the compatibility mode. Such plugins are considered "unstable" and the metrics reported by these plugins will change in the future. Thanks to @octo. #4236` + "\n",
+			wantMarkdown: "### Build/Packaging\n\n" +
+				`*   Build system: the '--enable-compatibility-mode' has been added to control whether or not to build plugins using the compatibility mode. Such plugins are considered "unstable" and the metrics reported by these plugins will change in the future. Thanks to @octo. #4236` + "\n",
 			wantFile: "2024-01-26, Version 6.0.1\n" +
+				"\tBuild/Packaging:\n" +
 				"\t* Build system: the '--enable-compatibility-mode' has been added to\n" +
 				"\t  control whether or not to build plugins using the compatibility mode.\n" +
 				"\t  Such plugins are considered \"unstable\" and the metrics reported by\n" +
@@ -98,10 +102,15 @@ ChangeLog: Build system: the '--enable-compatibility-mode' has been added to con
 					labels: []string{"core"},
 				},
 			},
-			wantMarkdown: "*   zzz: Text. Thanks to @user9. #9\n" +
+			wantMarkdown: "### Core\n\n" +
+				"*   zzz: Text. Thanks to @user9. #9\n" +
+				"\n" +
+				"### Plugins\n\n" +
 				"*   aaa: Text. Thanks to @user1. #1\n",
 			wantFile: "2024-01-26, Version 6.0.1\n" +
+				"\tCore:\n" +
 				"\t* zzz: Text. Thanks to @user9. #9\n" +
+				"\tPlugins:\n" +
 				"\t* aaa: Text. Thanks to @user1. #1\n",
 		},
 		{
@@ -122,9 +131,11 @@ ChangeLog: Build system: the '--enable-compatibility-mode' has been added to con
 					labels: []string{"core"},
 				},
 			},
-			wantMarkdown: "*   zzz: Text. Thanks to @user1. #1\n" +
+			wantMarkdown: "### Core\n\n" +
+				"*   zzz: Text. Thanks to @user1. #1\n" +
 				"*   aaa: Text. Thanks to @user9. #9\n",
 			wantFile: "2024-01-26, Version 6.0.1\n" +
+				"\tCore:\n" +
 				"\t* zzz: Text. Thanks to @user1. #1\n" +
 				"\t* aaa: Text. Thanks to @user9. #9\n",
 		},
@@ -144,9 +155,11 @@ ChangeLog: Build system: the '--enable-compatibility-mode' has been added to con
 					number: 9,
 				},
 			},
-			wantMarkdown: "*   aaa: Text. Thanks to @user9. #9\n" +
+			wantMarkdown: "### Plugins\n\n" +
+				"*   aaa: Text. Thanks to @user9. #9\n" +
 				"*   zzz: Text. Thanks to @user1. #1\n",
 			wantFile: "2024-01-26, Version 6.0.1\n" +
+				"\tPlugins:\n" +
 				"\t* aaa: Text. Thanks to @user9. #9\n" +
 				"\t* zzz: Text. Thanks to @user1. #1\n",
 		},
@@ -167,3 +180,352 @@ ChangeLog: Build system: the '--enable-compatibility-mode' has been added to con
 		})
 	}
 }
+
+func TestPolicyOrder(t *testing.T) {
+	p := Policy{
+		Categories: map[string]string{
+			"Breaking": "breaking",
+			"core":     "core",
+			"Fix":      "fixes",
+		},
+		Order: []string{"breaking", "core"},
+	}
+
+	prs := []pr{
+		{body: "ChangeLog: zzz: Text.", author: "user1", number: 1, labels: []string{"Fix"}},
+		{body: "ChangeLog: aaa: Text.", author: "user2", number: 2},
+		{body: "ChangeLog: Core: Text.", author: "user3", number: 3, labels: []string{"core"}},
+		{body: "ChangeLog: Breaking: Text.", author: "user4", number: 4, labels: []string{"core", "Breaking"}},
+	}
+
+	data := p.New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), version.Version{}, makePullRequests(prs))
+
+	want := "*   Breaking: Text. Thanks to @user4. #4\n" +
+		"*   Core: Text. Thanks to @user3. #3\n" +
+		"*   aaa: Text. Thanks to @user2. #2\n" +
+		"*   zzz: Text. Thanks to @user1. #1\n"
+	if diff := cmp.Diff(want, data.Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestPolicyScopeCategories(t *testing.T) {
+	p := Policy{
+		Categories: map[string]string{
+			"core": "core",
+		},
+		Order:           []string{"core", "cpu"},
+		ScopeCategories: true,
+	}
+
+	prs := []pr{
+		{title: "fix(memory): Fix.", body: "ChangeLog: aaa: Text.", author: "user1", number: 1},
+		{title: "feat(cpu): Feature.", body: "ChangeLog: zzz: Text.", author: "user2", number: 2},
+		{title: "fix(daemon): Fix.", body: "ChangeLog: Core: Text.", author: "user3", number: 3, labels: []string{"core"}},
+	}
+
+	data := p.New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), version.Version{}, makePullRequests(prs))
+
+	want := "*   Core: Text. Thanks to @user3. #3\n" +
+		"*   zzz: Text. Thanks to @user2. #2\n" +
+		"*   aaa: Text. Thanks to @user1. #1\n"
+	if diff := cmp.Diff(want, data.Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	prs := []pr{
+		{body: "ChangeLog: CPU plugin: A crash has been fixed.", author: "user1", number: 1, labels: []string{"Fix"}},
+		{body: "ChangeLog: collectd: New config option.", author: "user2", number: 2, labels: []string{"core", "Feature"}},
+		{body: "ChangeLog: Build system: Support for musl.", author: "user3", number: 3, labels: []string{"Feature"}},
+		{body: "ChangeLog: CPU plugin: New metric.", author: "user4", number: 4, labels: []string{"Feature"}},
+		{body: "ChangeLog: collectd: A memory leak has been fixed.", author: "user5", number: 5, labels: []string{"Fix"}},
+		{body: "ChangeLog: Memory plugin: Metric renamed.", author: "user6", number: 6, labels: []string{"Breaking", "Feature"}},
+		{body: "ChangeLog: Disk plugin: New metric.", author: "user7", number: 7, labels: []string{"Feature"}},
+		{body: "ChangeLog: Disk plugin: Documentation updated.", author: "user8", number: 8},
+	}
+
+	data := New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), version.Version{}, makePullRequests(prs))
+
+	want := "### Breaking changes\n\n" +
+		"*   Memory plugin: Metric renamed. Thanks to @user6. #6\n" +
+		"\n" +
+		"### New features\n\n" +
+		"*   CPU plugin: New metric. Thanks to @user4. #4\n" +
+		"*   Disk plugin: New metric. Thanks to @user7. #7\n" +
+		"\n" +
+		"### Bug fixes\n\n" +
+		"*   CPU plugin: A crash has been fixed. Thanks to @user1. #1\n" +
+		"\n" +
+		"### Core\n\n" +
+		"*   collectd: New config option. Thanks to @user2. #2\n" +
+		"*   collectd: A memory leak has been fixed. Thanks to @user5. #5\n" +
+		"\n" +
+		"### Plugins\n\n" +
+		"*   Disk plugin: Documentation updated. Thanks to @user8. #8\n" +
+		"\n" +
+		"### Build/Packaging\n\n" +
+		"*   Build system: Support for musl. Thanks to @user3. #3\n"
+	if diff := cmp.Diff(want, data.Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestPolicyKinds(t *testing.T) {
+	p := Policy{
+		Categories: map[string]string{
+			"Feature": "features",
+			"Fix":     "fixes",
+			"core":    "core",
+		},
+		Sections: []Section{
+			{Title: "Core", Categories: []string{"core"}},
+			{Title: "Plugins"},
+		},
+		Kinds:    []string{"features", "fixes"},
+		Prefixes: map[string]string{"collectd": "core"},
+		Plugins:  KnownPlugins,
+	}
+
+	prs := []pr{
+		{body: "ChangeLog: CPU plugin: A crash has been fixed.", author: "user1", number: 1, labels: []string{"Fix"}},
+		{body: "ChangeLog: collectd: A memory leak has been fixed.", author: "user2", number: 2, labels: []string{"Fix"}},
+		{body: "ChangeLog: Disk plugin: New metric.", author: "user3", number: 3, labels: []string{"Feature"}},
+		{body: "ChangeLog: collectd: New config option.", author: "user4", number: 4, labels: []string{"Feature"}},
+		{body: "ChangeLog: CPU plugin: New metric.", author: "user5", number: 5, labels: []string{"Feature"}},
+	}
+
+	data := p.New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), version.Version{}, makePullRequests(prs))
+
+	// Features are listed before fixes, but the entries of a plugin are kept
+	// together.
+	want := "### Core\n\n" +
+		"*   collectd: New config option. Thanks to @user4. #4\n" +
+		"*   collectd: A memory leak has been fixed. Thanks to @user2. #2\n" +
+		"\n" +
+		"### Plugins\n\n" +
+		"*   CPU plugin:\n" +
+		"    *   New metric. Thanks to @user5. #5\n" +
+		"    *   A crash has been fixed. Thanks to @user1. #1\n" +
+		"*   Disk plugin: New metric. Thanks to @user3. #3\n"
+	if diff := cmp.Diff(want, data.Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestPolicySections(t *testing.T) {
+	p := Policy{
+		Categories: map[string]string{
+			"Breaking": "breaking",
+			"Fix":      "fixes",
+			"core":     "core",
+		},
+		Order: []string{"core"},
+		Sections: []Section{
+			{Title: "Breaking changes", Categories: []string{"breaking"}},
+			{Title: "Bug fixes", Categories: []string{"fixes"}},
+			{Title: "Core", Categories: []string{"core"}},
+			{Title: "Build", Categories: []string{"build"}},
+		},
+	}
+
+	prs := []pr{
+		{body: "ChangeLog: zzz: Text.", author: "user1", number: 1, labels: []string{"Fix"}},
+		{body: "ChangeLog: aaa: Text.", author: "user2", number: 2},
+		{body: "ChangeLog: Core: Text.", author: "user3", number: 3, labels: []string{"core"}},
+		{body: "ChangeLog: Core: Fix.", author: "user4", number: 4, labels: []string{"core", "Fix"}},
+		{body: "ChangeLog: Breaking: Text.", author: "user5", number: 5, labels: []string{"Breaking"}},
+	}
+
+	data := p.New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), version.Version{}, makePullRequests(prs))
+
+	// The "Build" section is empty and omitted. Entries in no section are
+	// listed last, under "Other changes".
+	wantMarkdown := "### Breaking changes\n\n" +
+		"*   Breaking: Text. Thanks to @user5. #5\n" +
+		"\n" +
+		"### Bug fixes\n\n" +
+		"*   Core: Fix. Thanks to @user4. #4\n" +
+		"*   zzz: Text. Thanks to @user1. #1\n" +
+		"\n" +
+		"### Core\n\n" +
+		"*   Core: Text. Thanks to @user3. #3\n" +
+		"\n" +
+		"### Other changes\n\n" +
+		"*   aaa: Text. Thanks to @user2. #2\n"
+	if diff := cmp.Diff(wantMarkdown, data.Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+
+	wantFile := "2024-01-26, Version 0.0.0\n" +
+		"\tBreaking changes:\n" +
+		"\t* Breaking: Text. Thanks to @user5. #5\n" +
+		"\tBug fixes:\n" +
+		"\t* Core: Fix. Thanks to @user4. #4\n" +
+		"\t* zzz: Text. Thanks to @user1. #1\n" +
+		"\tCore:\n" +
+		"\t* Core: Text. Thanks to @user3. #3\n" +
+		"\tOther changes:\n" +
+		"\t* aaa: Text. Thanks to @user2. #2\n"
+	if diff := cmp.Diff(wantFile, data.FileFormat()); diff != "" {
+		t.Errorf("Data.FileFormat() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestPluginGroups(t *testing.T) {
+	p := Policy{
+		Plugins: []string{"CPU", "Write Prometheus"},
+	}
+
+	prs := []pr{
+		{body: "ChangeLog: write_prometheus plugin: Text one.", author: "user1", number: 1},
+		{body: "ChangeLog: Write Prometheus plugin: Text two, which is long enough to require wrapping the line.", author: "user2", number: 2},
+		{body: "ChangeLog: Fix overflow.", author: "user3", number: 3, labels: []string{"plugin: cpu"}},
+		{body: "ChangeLog: Foo plugin: Text.", author: "user4", number: 4},
+		{body: "ChangeLog: Build system: Text.", author: "user5", number: 5},
+	}
+
+	data := p.New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), version.Version{}, makePullRequests(prs))
+
+	wantMarkdown := "*   Build system: Text. Thanks to @user5. #5\n" +
+		"*   CPU plugin: Fix overflow. Thanks to @user3. #3\n" +
+		"*   Foo plugin: Text. Thanks to @user4. #4\n" +
+		"*   Write Prometheus plugin:\n" +
+		"    *   Text one. Thanks to @user1. #1\n" +
+		"    *   Text two, which is long enough to require wrapping the line. Thanks to @user2. #2\n"
+	if diff := cmp.Diff(wantMarkdown, data.Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+
+	wantFile := "2024-01-26, Version 0.0.0\n" +
+		"\t* Build system: Text. Thanks to @user5. #5\n" +
+		"\t* CPU plugin: Fix overflow. Thanks to @user3. #3\n" +
+		"\t* Foo plugin: Text. Thanks to @user4. #4\n" +
+		"\t* Write Prometheus plugin:\n" +
+		"\t  - Text one. Thanks to @user1. #1\n" +
+		"\t  - Text two, which is long enough to require wrapping the line. Thanks\n" +
+		"\t    to @user2. #2\n"
+	if diff := cmp.Diff(wantFile, data.FileFormat()); diff != "" {
+		t.Errorf("Data.FileFormat() differs (-want/+got):\n%s", diff)
+	}
+
+	wantWarnings := []string{`unknown plugin "Foo" in the ChangeLog entry of #4`}
+	if diff := cmp.Diff(wantWarnings, data.Warnings()); diff != "" {
+		t.Errorf("Data.Warnings() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestParseBody(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		want     []entryText
+		wantNone bool
+	}{
+		{
+			name: "single line",
+			body: "Description.\r\n\r\nChangeLog: Text.\r\n",
+			want: []entryText{{text: "Text."}},
+		},
+		{
+			name: "multiple lines",
+			body: "ChangeLog: CPU plugin: Text.\nChangeLog(fix): Memory plugin: Fix.\n",
+			want: []entryText{
+				{text: "CPU plugin: Text."},
+				{category: "fix", text: "Memory plugin: Fix."},
+			},
+		},
+		{
+			name: "block",
+			body: "Description.\n\n```ChangeLog\nFirst entry,\nspanning lines.\n\nChangeLog: Second entry.\n```\n\nChangeLog(core): Third entry.\n",
+			want: []entryText{
+				{text: "First entry, spanning lines."},
+				{text: "ChangeLog: Second entry."},
+				{category: "core", text: "Third entry."},
+			},
+		},
+		{
+			name: "block with category",
+			body: "```ChangeLog(feature)\nText.\n```\n",
+			want: []entryText{{category: "feature", text: "Text."}},
+		},
+		{
+			name:     "opt-out",
+			body:     "Typo fix.\n\nChangeLog: None.\n",
+			wantNone: true,
+		},
+		{
+			name: "no entry",
+			body: "Typo fix.\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotNone := parseBody(tc.body)
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(entryText{})); diff != "" {
+				t.Errorf("parseBody() differs (-want/+got):\n%s", diff)
+			}
+			if gotNone != tc.wantNone {
+				t.Errorf("parseBody() none = %v, want %v", gotNone, tc.wantNone)
+			}
+		})
+	}
+}
+
+func TestMultipleEntries(t *testing.T) {
+	p := Policy{
+		Categories: map[string]string{
+			"Feature": "features",
+			"Fix":     "fixes",
+		},
+		Sections: []Section{
+			{Title: "New features", Categories: []string{"features"}},
+			{Title: "Bug fixes", Categories: []string{"fixes"}},
+		},
+	}
+
+	prs := []pr{
+		{
+			body:   "ChangeLog: CPU plugin: New metric.\nChangeLog(fix): Memory plugin: Overflow fixed.\n",
+			author: "user1",
+			number: 1,
+			labels: []string{"Feature"},
+		},
+		{body: "ChangeLog: none", author: "user2", number: 2, labels: []string{"Fix"}},
+	}
+
+	data := p.New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), version.Version{}, makePullRequests(prs))
+
+	want := "### New features\n\n" +
+		"*   CPU plugin: New metric. Thanks to @user1. #1\n" +
+		"\n" +
+		"### Bug fixes\n\n" +
+		"*   Memory plugin: Overflow fixed. Thanks to @user1. #1\n"
+	if diff := cmp.Diff(want, data.Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestDataMarshalJSON(t *testing.T) {
+	v, err := version.Parse("6.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prs := []pr{
+		{body: "ChangeLog: Core: Text.", author: "user1", number: 1, labels: []string{"core"}},
+	}
+	data := New(time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC), v, makePullRequests(prs))
+
+	got, err := data.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"date":"2024-01-26","version":"6.0.1","entries":[{"text":"Core: Text.","author":"user1","pr":1,"category":"core","section":"Core"}]}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Data.MarshalJSON() differs (-want/+got):\n%s", diff)
+	}
+}
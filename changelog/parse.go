@@ -0,0 +1,327 @@
+package changelog
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/collectd/releaser/version"
+)
+
+var (
+	// headerRE matches the first line of a ChangeLog file section.
+	headerRE = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}), Version (.+)$`)
+	// titleRE matches section titles, e.g. "\tBug fixes:".
+	titleRE = regexp.MustCompile(`^\t([^\s*].*):$`)
+	// groupRE matches the common bullet of a plugin group, e.g. "\t* CPU
+	// plugin:".
+	groupRE = regexp.MustCompile(`^\t\* (.+) plugin:$`)
+	// thanksRE matches the text of an entry created from a pull request.
+	thanksRE = regexp.MustCompile(`^(.*) Thanks to @(\S+)\. #([0-9]+)$`)
+)
+
+// Parse parses the content of a ChangeLog file into its sections, newest
+// first. A section starts with a header like "2024-01-26, Version 6.0.1" and
+// is separated from the next one by an empty line, as written by the
+// releaser. File renders the returned data back into content.
+//
+// Older ChangeLogs do not follow this format throughout. Lines that are not
+// entries are kept as raw text, and so are sections with a header naming a
+// version the releaser does not use, e.g. "Version 4.0", or with a structure
+// it does not write, e.g. several empty lines. Such sections have no entries
+// and are reproduced unchanged by File. Text before the first header is
+// kept as a raw section, too.
+func Parse(content []byte) []Data {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var ret []Data
+	for start := 0; start < len(lines); {
+		end := start + 1
+		for end < len(lines) && !headerRE.MatchString(strings.TrimSuffix(lines[end], "\n")) {
+			end++
+		}
+		chunk := lines[start:end]
+		start = end
+
+		// All but the last section end with the empty line separating
+		// them from the next section, which File adds back.
+		last := end == len(lines)
+		if !last {
+			if n := len(chunk); n > 1 && chunk[n-1] == "\n" && chunk[n-2] != "\n" {
+				if cl, ok := parseSection(chunk[:n-1]); ok {
+					ret = append(ret, cl)
+					continue
+				}
+			}
+		} else if n := len(chunk); chunk[n-1] != "\n" && strings.HasSuffix(chunk[n-1], "\n") {
+			if cl, ok := parseSection(chunk); ok {
+				ret = append(ret, cl)
+				continue
+			}
+		}
+
+		ret = append(ret, rawSection(chunk))
+	}
+
+	return ret
+}
+
+// File returns the content of a ChangeLog file consisting of the sections
+// data, newest first.
+func File(data []Data) []byte {
+	var b bytes.Buffer
+	for i, cl := range data {
+		if i != 0 && data[i-1].raw == "" {
+			fmt.Fprintln(&b)
+		}
+		fmt.Fprint(&b, cl.FileFormat())
+	}
+	return b.Bytes()
+}
+
+// rawSection returns a section consisting of the raw text lines, including
+// the empty lines separating it from the next section. The date and version
+// are set if the header can be parsed.
+func rawSection(lines []string) Data {
+	cl := Data{
+		raw: strings.Join(lines, ""),
+	}
+	if m := headerRE.FindStringSubmatch(strings.TrimSuffix(lines[0], "\n")); m != nil {
+		cl.date, _ = time.Parse("2006-01-02", m[1])
+		cl.version, _ = version.Parse(m[2])
+	}
+	return cl
+}
+
+// Promote replaces the sections of the pre-releases of final in the ChangeLog
+// file content, e.g. of 6.1.0-rc0 and 6.1.0-rc1, with a single section for
+// final, dated date, that holds all of their entries. The merged section takes
+// the place of the newest pre-release.
+func Promote(content []byte, date time.Time, final version.Version) ([]byte, error) {
+	data := Parse(content)
+
+	var (
+		ret []Data
+		pre []Data
+		at  = -1
+	)
+	for _, cl := range data {
+		if v, err := cl.version.Promote(); err != nil || v.Compare(final) != 0 {
+			ret = append(ret, cl)
+			continue
+		}
+		if at == -1 {
+			at = len(ret)
+			ret = append(ret, Data{})
+		}
+		pre = append(pre, cl)
+	}
+	if at == -1 {
+		return nil, fmt.Errorf("no ChangeLog section for a pre-release of version %s", final)
+	}
+
+	// Merge the entries oldest first.
+	for i, j := 0, len(pre)-1; i < j; i, j = i+1, j-1 {
+		pre[i], pre[j] = pre[j], pre[i]
+	}
+	ret[at] = Merge(date, final, pre)
+
+	return File(ret), nil
+}
+
+// Merge returns the ChangeLog data for version, dated date, with the entries
+// of data, oldest first. Entries keep their formatting and section. Sections
+// with the same title are joined. They are ordered as in the newest data,
+// followed by the sections only found in older data.
+func Merge(date time.Time, version version.Version, data []Data) Data {
+	ret := Data{
+		date:    date,
+		version: version,
+	}
+
+	index := make(map[string]int)
+	for i := len(data) - 1; i >= 0; i-- {
+		titles := data[i].sections
+		if titles == nil && len(data[i].entries) != 0 {
+			titles = []string{otherTitle}
+		}
+		for _, title := range titles {
+			if _, ok := index[title]; !ok {
+				index[title] = len(ret.sections)
+				ret.sections = append(ret.sections, title)
+			}
+		}
+	}
+	// Without any titled section, the entries are not grouped either.
+	if len(ret.sections) == 1 && ret.sections[0] == otherTitle {
+		ret.sections = nil
+	}
+
+	groups := 0
+	for _, cl := range data {
+		maxGroup := 0
+		for _, e := range cl.entries {
+			if ret.sections != nil {
+				title := otherTitle
+				if cl.sections != nil {
+					title = cl.sections[e.section]
+				}
+				e.section = index[title]
+			}
+			if e.group > 0 {
+				maxGroup = max(maxGroup, e.group)
+				e.group += groups
+			}
+			ret.entries = append(ret.entries, e)
+		}
+		groups += maxGroup
+	}
+
+	sort.SliceStable(ret.entries, func(i, j int) bool {
+		return ret.entries[i].section < ret.entries[j].section
+	})
+	return ret
+}
+
+// parseSection parses the section consisting of lines, which end in
+// newlines. It returns false if the section does not have the format written
+// by FileFormat, other than lines that are not entries. These are kept as raw
+// entries.
+func parseSection(chunk []string) (Data, bool) {
+	lines := make([]string, len(chunk))
+	for i, line := range chunk {
+		lines[i] = strings.TrimSuffix(line, "\n")
+	}
+
+	m := headerRE.FindStringSubmatch(lines[0])
+	if m == nil {
+		return Data{}, false
+	}
+	date, err := time.Parse("2006-01-02", m[1])
+	if err != nil {
+		return Data{}, false
+	}
+	v, err := version.Parse(m[2])
+	if err != nil || Header(date, v) != lines[0] {
+		return Data{}, false
+	}
+
+	cl := Data{
+		date:    date,
+		version: v,
+	}
+	// sectionStart is the index of the first entry of the current section.
+	sectionStart := 0
+	group := 0
+	for i := 1; i < len(lines); {
+		line := lines[i]
+
+		switch m := titleRE.FindStringSubmatch(line); {
+		case line == "":
+			return Data{}, false
+
+		case m != nil:
+			if len(cl.entries) != 0 && cl.sections == nil {
+				return Data{}, false
+			}
+			if cl.sections != nil && len(cl.entries) == sectionStart {
+				return Data{}, false
+			}
+			cl.sections = append(cl.sections, m[1])
+			sectionStart = len(cl.entries)
+			i++
+
+		case groupRE.MatchString(line) && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t  - "):
+			group++
+			plugin := groupRE.FindStringSubmatch(line)[1]
+			for i++; i < len(lines) && strings.HasPrefix(lines[i], "\t  - "); {
+				var raw []string
+				raw, i = bulletLines(lines, i, "\t    ")
+				e := parsedEntry(plugin+" plugin: "+bulletText(raw, "\t  - ", "\t    "), raw)
+				e.plugin = plugin
+				e.group = group
+				e.section = len(cl.sections) - 1
+				cl.entries = append(cl.entries, e)
+			}
+
+		case strings.HasPrefix(line, "\t* "):
+			var raw []string
+			raw, i = bulletLines(lines, i, "\t  ")
+			e := parsedEntry(bulletText(raw, "\t* ", "\t  "), raw)
+			if m := pluginRE.FindStringSubmatch(e.text); m != nil {
+				e.plugin = m[1]
+			}
+			e.group = -1
+			e.section = len(cl.sections) - 1
+			cl.entries = append(cl.entries, e)
+
+		default:
+			// Keep lines that are not entries as they are.
+			cl.entries = append(cl.entries, entry{
+				text:    strings.TrimSpace(line),
+				raw:     line + "\n",
+				group:   -1,
+				section: len(cl.sections) - 1,
+			})
+			i++
+		}
+	}
+	if cl.sections != nil && len(cl.entries) == sectionStart {
+		return Data{}, false
+	}
+	if cl.sections == nil {
+		for j := range cl.entries {
+			cl.entries[j].section = 0
+		}
+	}
+
+	return cl, true
+}
+
+// bulletLines returns the bullet point starting at lines[i], i.e. lines[i]
+// and the following lines starting with indent, and the index of the line
+// following it.
+func bulletLines(lines []string, i int, indent string) ([]string, int) {
+	ret := []string{lines[i]}
+	for i++; i < len(lines) && strings.HasPrefix(lines[i], indent); i++ {
+		ret = append(ret, lines[i])
+	}
+	return ret, i
+}
+
+// bulletText returns the text of the bullet point consisting of lines, with
+// the bullet and the indentation of continuation lines removed.
+func bulletText(lines []string, bullet, indent string) string {
+	var words []string
+	for i, line := range lines {
+		if i == 0 {
+			line = strings.TrimPrefix(line, bullet)
+		} else {
+			line = strings.TrimPrefix(line, indent)
+		}
+		words = append(words, strings.Fields(line)...)
+	}
+	return strings.Join(words, " ")
+}
+
+// parsedEntry returns the entry with text, parsed from the lines raw. The
+// author and pull request are taken from the "Thanks to @<author>. #<number>"
+// suffix of text, if present.
+func parsedEntry(text string, raw []string) entry {
+	e := entry{
+		text: text,
+		raw:  strings.Join(raw, "\n") + "\n",
+	}
+	if m := thanksRE.FindStringSubmatch(text); m != nil {
+		e.text, e.author = m[1], m[2]
+		e.prID, _ = strconv.Atoi(m[3])
+	}
+	return e
+}
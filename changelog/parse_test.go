@@ -0,0 +1,251 @@
+package changelog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/collectd/releaser/version"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	v, err := version.Parse("6.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prs := []pr{
+		{body: "ChangeLog: Write Prometheus plugin: Text one.", author: "user1", number: 1, labels: []string{"Feature"}},
+		{body: "ChangeLog: Write Prometheus plugin: Text two, which is long enough to require wrapping the line.", author: "user2", number: 2, labels: []string{"Feature"}},
+		{body: "ChangeLog: CPU plugin: A crash has been fixed.", author: "user3", number: 3, labels: []string{"Fix"}},
+		{body: "ChangeLog: collectd: A memory leak has been fixed.", author: "user4", number: 4, labels: []string{"core"}},
+	}
+	generated := New(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), v, makePullRequests(prs)).FileFormat()
+	collectd, err := os.ReadFile("testdata/ChangeLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "generated",
+			content: generated + "\n" + "2024-01-01, Version 6.0.0\n\t* Initial release.\n",
+		},
+		{
+			name: "historical",
+			content: "2017-11-17, Version 5.8.0\n" +
+				"\t* collectd: The core daemon is now completely licensed under the MIT\n" +
+				"\t  license.\n" +
+				"\t* Build system:   irregular   spacing and\n" +
+				"\t  a short line.\n" +
+				"\t* CPU plugin: Entries for the same plugin are not grouped.\n" +
+				"\t* CPU plugin: Thanks to @octo. #2000\n" +
+				"\t* Ceph plugin:\n" +
+				"\t  - A group with a single entry.\n" +
+				"\n" +
+				"2017-06-06, Version 5.7.2\n" +
+				"\t* Write HTTP plugin: Fixed. Thanks to @user1. #1\n",
+		},
+		{
+			// testdata/ChangeLog follows collectd's ChangeLog, including
+			// the formats of its oldest sections.
+			name:    "collectd",
+			content: string(collectd),
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := Parse([]byte(tc.content))
+			if diff := cmp.Diff(tc.content, string(File(data))); diff != "" {
+				t.Errorf("File(Parse()) differs (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	content := "2024-03-01, Version 6.1.0\n" +
+		"\tNew features:\n" +
+		"\t* Write Prometheus plugin:\n" +
+		"\t  - Text one. Thanks to @user1. #1\n" +
+		"\t  - Text two, which is long enough to require wrapping the line. Thanks\n" +
+		"\t    to @user2. #2\n" +
+		"\tBug fixes:\n" +
+		"\t* CPU plugin: A crash has been fixed. Thanks to @user3. #3\n" +
+		"\n" +
+		"2024-01-01, Version 6.0.0\n" +
+		"\t* Initial release.\n"
+
+	data := Parse([]byte(content))
+	if len(data) != 2 {
+		t.Fatalf("Parse() returned %d sections, want 2", len(data))
+	}
+
+	var got []string
+	for _, cl := range data {
+		b, err := cl.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(b))
+	}
+	want := []string{
+		`{"date":"2024-03-01","version":"6.1.0","entries":[` +
+			`{"text":"Write Prometheus plugin: Text one.","author":"user1","pr":1,"section":"New features","plugin":"Write Prometheus"},` +
+			`{"text":"Write Prometheus plugin: Text two, which is long enough to require wrapping the line.","author":"user2","pr":2,"section":"New features","plugin":"Write Prometheus"},` +
+			`{"text":"CPU plugin: A crash has been fixed.","author":"user3","pr":3,"section":"Bug fixes","plugin":"CPU"}]}`,
+		`{"date":"2024-01-01","version":"6.0.0","entries":[{"text":"Initial release.","author":"","pr":0}]}`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Parse() differs (-want/+got):\n%s", diff)
+	}
+
+	wantMarkdown := "### New features\n\n" +
+		"*   Write Prometheus plugin:\n" +
+		"    *   Text one. Thanks to @user1. #1\n" +
+		"    *   Text two, which is long enough to require wrapping the line. Thanks to @user2. #2\n" +
+		"\n" +
+		"### Bug fixes\n\n" +
+		"*   CPU plugin: A crash has been fixed. Thanks to @user3. #3\n"
+	if diff := cmp.Diff(wantMarkdown, data[0].Markdown()); diff != "" {
+		t.Errorf("Data.Markdown() differs (-want/+got):\n%s", diff)
+	}
+}
+
+func TestParseRaw(t *testing.T) {
+	collectd, err := os.ReadFile("testdata/ChangeLog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		content string
+		// want lists the versions of the parsed sections, "raw" for
+		// sections kept as raw text.
+		want []string
+	}{
+		{
+			name:    "missing newline",
+			content: "2024-01-01, Version 6.0.0\n\t* Initial release.",
+			want:    []string{"raw"},
+		},
+		{
+			name:    "no header",
+			content: "\t* Initial release.\n",
+			want:    []string{"raw"},
+		},
+		{
+			name:    "non-canonical version",
+			content: "2024-03-01, Version 6.1.0\n\t* Text.\n\n2024-01-01, Version 6.0\n\t* Initial release.\n",
+			want:    []string{"6.1.0", "raw"},
+		},
+		{
+			name:    "two empty lines",
+			content: "2024-03-01, Version 6.1.0\n\t* Text.\n\n\n2024-01-01, Version 6.0.0\n\t* Initial release.\n",
+			want:    []string{"raw", "6.0.0"},
+		},
+		{
+			name:    "unexpected line",
+			content: "2024-01-01, Version 6.0.0\n\t* Initial release.\n  indented with spaces\n",
+			want:    []string{"6.0.0"},
+		},
+		{
+			name:    "empty section",
+			content: "2024-01-01, Version 6.0.0\n\tNew features:\n\tBug fixes:\n\t* Text.\n",
+			want:    []string{"raw"},
+		},
+		{
+			name:    "title after entries",
+			content: "2024-01-01, Version 6.0.0\n\t* Text.\n\tBug fixes:\n\t* Text.\n",
+			want:    []string{"raw"},
+		},
+		{
+			name:    "collectd",
+			content: string(collectd),
+			want:    []string{"6.1.0", "5.12.0", "5.8.0", "raw", "raw", "raw", "raw"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := Parse([]byte(tc.content))
+
+			var got []string
+			for _, cl := range data {
+				if cl.raw != "" {
+					got = append(got, "raw")
+					continue
+				}
+				got = append(got, cl.Version().String())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Parse() sections differ (-want/+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.content, string(File(data))); diff != "" {
+				t.Errorf("File(Parse()) differs (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPromote(t *testing.T) {
+	content := "2024-03-08, Version 6.1.0-rc1\n" +
+		"\tCore:\n" +
+		"\t* collectd: A crash has been fixed. Thanks to @user3. #3\n" +
+		"\tPlugins:\n" +
+		"\t* CPU plugin:\n" +
+		"\t  - Text three. Thanks to @user4. #4\n" +
+		"\t  - Text four. Thanks to @user5. #5\n" +
+		"\n" +
+		"2024-03-01, Version 6.1.0-rc0\n" +
+		"\tPlugins:\n" +
+		"\t* CPU plugin:\n" +
+		"\t  - Text one. Thanks to @user1. #1\n" +
+		"\t  - Text two. Thanks to @user2. #2\n" +
+		"\n" +
+		"2024-01-01, Version 6.0.0\n" +
+		"\t* Initial release.\n"
+
+	final, err := version.Parse("6.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Promote([]byte(content), time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC), final)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "2024-03-15, Version 6.1.0\n" +
+		"\tCore:\n" +
+		"\t* collectd: A crash has been fixed. Thanks to @user3. #3\n" +
+		"\tPlugins:\n" +
+		"\t* CPU plugin:\n" +
+		"\t  - Text one. Thanks to @user1. #1\n" +
+		"\t  - Text two. Thanks to @user2. #2\n" +
+		"\t* CPU plugin:\n" +
+		"\t  - Text three. Thanks to @user4. #4\n" +
+		"\t  - Text four. Thanks to @user5. #5\n" +
+		"\n" +
+		"2024-01-01, Version 6.0.0\n" +
+		"\t* Initial release.\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Promote() differs (-want/+got):\n%s", diff)
+	}
+
+	other, err := version.Parse("6.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Promote([]byte(content), time.Now(), other); err == nil {
+		t.Errorf("Promote(%v) succeeded, want error about the missing pre-release", other)
+	}
+}
@@ -0,0 +1,218 @@
+package changelog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// KnownPlugins lists the names of collectd's plugins, as they are spelled in
+// the ChangeLog.
+var KnownPlugins = []string{
+	"Aggregation",
+	"AMQP",
+	"AMQP1",
+	"Apache",
+	"APC UPS",
+	"Apple Sensors",
+	"Aquaero",
+	"Ascent",
+	"Barometer",
+	"Battery",
+	"BIND",
+	"Buddyinfo",
+	"Capabilities",
+	"Ceph",
+	"cgroups",
+	"Chrony",
+	"Check Uptime",
+	"Conntrack",
+	"Contextswitch",
+	"CPU",
+	"CPUFreq",
+	"CPUSleep",
+	"CSV",
+	"cURL",
+	"cURL-JSON",
+	"cURL-XML",
+	"DBI",
+	"DCPMM",
+	"Disk",
+	"DNS",
+	"DPDK Telemetry",
+	"DPDKEvents",
+	"DPDKStat",
+	"DRBD",
+	"E-Mail",
+	"Entropy",
+	"Ethstat",
+	"Exec",
+	"FHCount",
+	"Filecount",
+	"FSCache",
+	"GMond",
+	"GPS",
+	"GPU NVIDIA",
+	"gRPC",
+	"HDDTemp",
+	"Hugepages",
+	"InfiniBand",
+	"Intel PMU",
+	"Intel RDT",
+	"Interface",
+	"IPC",
+	"IPMI",
+	"IPStats",
+	"IPTables",
+	"IPVS",
+	"IRQ",
+	"Java",
+	"Load",
+	"LogFile",
+	"Log Logstash",
+	"Logparser",
+	"LPAR",
+	"Lua",
+	"LVM",
+	"MadWifi",
+	"Match Empty Counter",
+	"Match Hashed",
+	"Match Regex",
+	"Match Timediff",
+	"Match Value",
+	"MBMon",
+	"MCELog",
+	"MD",
+	"MDEvents",
+	"memcachec",
+	"memcached",
+	"Memory",
+	"MIC",
+	"Modbus",
+	"MQTT",
+	"Multimeter",
+	"MySQL",
+	"NetApp",
+	"Netlink",
+	"Netstat UDP",
+	"Network",
+	"NFS",
+	"nginx",
+	"Notify Desktop",
+	"Notify Email",
+	"Notify Nagios",
+	"NTPd",
+	"NUMA",
+	"NUT",
+	"OLSRd",
+	"OneWire",
+	"OpenLDAP",
+	"OpenVPN",
+	"Oracle",
+	"OVS Events",
+	"OVS Stats",
+	"PCIe Errors",
+	"Perl",
+	"PF",
+	"Pinba",
+	"Ping",
+	"PostgreSQL",
+	"PowerDNS",
+	"Procevent",
+	"Processes",
+	"Protocols",
+	"Python",
+	"Redfish",
+	"Redis",
+	"RouterOS",
+	"RRDCacheD",
+	"RRDtool",
+	"Sensors",
+	"Serial",
+	"Sigrok",
+	"Slurm",
+	"SMART",
+	"SNMP",
+	"SNMP Agent",
+	"StatsD",
+	"Swap",
+	"Synproxy",
+	"Sysevent",
+	"SysLog",
+	"Table",
+	"Tail",
+	"Tail CSV",
+	"Tape",
+	"Target Notification",
+	"Target Replace",
+	"Target Scale",
+	"Target Set",
+	"Target v5upgrade",
+	"TCPConns",
+	"TeamSpeak2",
+	"TED",
+	"Thermal",
+	"Threshold",
+	"Tokyo Tyrant",
+	"Turbostat",
+	"UBI",
+	"UnixSock",
+	"Uptime",
+	"Users",
+	"UUID",
+	"Varnish",
+	"Virt",
+	"VMem",
+	"VServer",
+	"Wireless",
+	"Write Graphite",
+	"Write HTTP",
+	"Write InfluxDB UDP",
+	"Write Kafka",
+	"Write Log",
+	"Write MongoDB",
+	"Write Open Telemetry",
+	"Write Prometheus",
+	"Write Redis",
+	"Write Riemann",
+	"Write Sensu",
+	"Write Stackdriver",
+	"Write Syslog",
+	"Write TSDB",
+	"XenCPU",
+	"XMMS",
+	"ZFS ARC",
+	"Zone",
+	"Zookeeper",
+}
+
+// pluginRE matches entries starting with a plugin name, e.g. "Write
+// Prometheus plugin: Text.".
+var pluginRE = regexp.MustCompile(`^([\w./+ -]+?) plugin: (.*)$`)
+
+// pluginLabelRE matches labels naming a plugin, e.g. "plugin: cpu".
+var pluginLabelRE = regexp.MustCompile(`^plugin: *(.+)$`)
+
+// pluginKey returns the form of name used to compare plugin names, ignoring
+// case, spaces, underscores and hyphens. "Write Prometheus" and
+// "write_prometheus" have the same key.
+func pluginKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// plugin returns the canonical spelling of the plugin name. If name is not a
+// known plugin, it returns name unchanged and false.
+func (p Policy) plugin(name string) (string, bool) {
+	key := pluginKey(name)
+	for _, known := range p.Plugins {
+		if pluginKey(known) == key {
+			return known, true
+		}
+	}
+	return name, false
+}
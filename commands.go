@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/collectd/releaser/workflow"
+)
+
+func runStatus(ctx context.Context, name string, args []string) error {
+	var jsonOut bool
+	fs, cfgFlags := commandFlags(name, &jsonOut)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	st, err := wf.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if jsonOut {
+		return printJSON(struct {
+			*workflow.Status
+			Green bool `json:"green"`
+		}{st, st.Green()})
+	}
+
+	fmt.Printf("Branch %q at %s\n", st.Branch, st.SHA)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, c := range st.Checks {
+		fmt.Fprintf(w, "  %s\t%s\n", c.Name, c.State)
+	}
+	w.Flush()
+
+	if err := st.Err(); err != nil {
+		return err
+	}
+	fmt.Println("All checks have succeeded.")
+	return nil
+}
+
+type prJSON struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title"`
+	Author string   `json:"author"`
+	Labels []string `json:"labels"`
+	Bump   string   `json:"bump"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+func runPRs(ctx context.Context, name string, args []string) error {
+	var jsonOut bool
+	fs, cfgFlags := commandFlags(name, &jsonOut)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	p, err := wf.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	prs := []prJSON{}
+	for _, pr := range p.PullRequests {
+		bump, reason := wf.Classify(pr)
+		e := prJSON{
+			Number: pr.GetNumber(),
+			Title:  pr.GetTitle(),
+			Author: pr.GetUser().GetLogin(),
+			Labels: []string{},
+			Bump:   bump.String(),
+			Reason: reason,
+		}
+		for _, l := range pr.Labels {
+			e.Labels = append(e.Labels, l.GetName())
+		}
+		prs = append(prs, e)
+	}
+
+	if jsonOut {
+		return printJSON(struct {
+			Since        string   `json:"since"`
+			PullRequests []prJSON `json:"pull_requests"`
+		}{p.Release.GetTagName(), prs})
+	}
+
+	fmt.Printf("%d pull request(s) since %q:\n", len(prs), p.Release.GetTagName())
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, pr := range prs {
+		fmt.Fprintf(w, "  #%d\t%s\t%s\t%s\t%s\n", pr.Number, pr.Bump, pr.Title, strings.Join(pr.Labels, ","), pr.Reason)
+	}
+	return w.Flush()
+}
+
+func runNextVersion(ctx context.Context, name string, args []string) error {
+	var jsonOut bool
+	fs, cfgFlags := commandFlags(name, &jsonOut)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	p, err := wf.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	next, decision, err := wf.NextVersion(p)
+	if err != nil {
+		return err
+	}
+
+	if jsonOut {
+		return printJSON(struct {
+			Previous string `json:"previous"`
+			Next     string `json:"next"`
+			Tag      string `json:"tag"`
+			Bump     string `json:"bump"`
+			PR       int    `json:"pr"`
+			Reason   string `json:"reason"`
+		}{p.Version.String(), next.String(), next.Tag(), decision.Bump.String(), decision.PR, decision.Reason})
+	}
+
+	fmt.Println(next)
+	fmt.Printf("%s -> %s: %s\n", p.Version, next, decision)
+	return nil
+}
+
+func runChangeLog(ctx context.Context, name string, args []string) error {
+	var jsonOut bool
+	fs, cfgFlags := commandFlags(name, &jsonOut)
+	format := fs.String("format", "markdown", `output format: "markdown" (release notes) or "file" (ChangeLog file)`)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	p, err := wf.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	next, _, err := wf.NextVersion(p)
+	if err != nil {
+		return err
+	}
+
+	cl := wf.ChangeLog(time.Now(), next, p.PullRequests)
+
+	switch {
+	case jsonOut:
+		return printJSON(cl)
+	case *format == "markdown":
+		fmt.Print(cl.Markdown())
+	case *format == "file":
+		fmt.Print(cl.FileFormat())
+	default:
+		return fmt.Errorf("invalid format %q", *format)
+	}
+	return nil
+}
+
+func runPlan(ctx context.Context, name string, args []string) error {
+	var jsonOut bool
+	fs, cfgFlags := commandFlags(name, &jsonOut)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	p, err := wf.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		fmt.Fprintln(os.Stderr, "Nothing to release.")
+		return nil
+	}
+
+	if jsonOut {
+		if err := printJSON(p); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(p)
+	}
+
+	if path := fs.Arg(0); path != "" {
+		if err := p.Write(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Plan written to %q.\n", path)
+	}
+	return nil
+}
+
+func runApply(ctx context.Context, name string, args []string) error {
+	fs, cfgFlags := commandFlags(name, nil)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing plan file")
+	}
+
+	p, err := workflow.ReadPlan(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return wf.Apply(ctx, p)
+}
+
+func runRelease(ctx context.Context, name string, args []string) error {
+	var jsonOut bool
+	fs, cfgFlags := commandFlags(name, &jsonOut)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	st, err := wf.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	if jsonOut {
+		return printJSON(st)
+	}
+	if st == nil {
+		fmt.Println("Nothing to release.")
+	}
+	return nil
+}
+
+func runPromote(ctx context.Context, name string, args []string) error {
+	fs, cfgFlags := commandFlags(name, nil)
+	wf, err := newReleaser(ctx, fs, cfgFlags, args)
+	if err != nil {
+		return err
+	}
+
+	return wf.Promote(ctx, fs.Arg(0))
+}
+
+func runConfig(ctx context.Context, name string, args []string) error {
+	fs, cfgFlags := commandFlags(name, nil)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.Arg(0) != "print" {
+		fs.Usage()
+		return errors.New(`unknown or missing subcommand, want "print"`)
+	}
+
+	cfg, err := loadConfig(cfgFlags)
+	fmt.Print(cfg)
+	return err
+}
@@ -0,0 +1,495 @@
+// Package config assembles the releaser configuration from a YAML file,
+// environment variables and command line flags, in increasing order of
+// precedence.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/collectd/releaser/policy"
+	"github.com/collectd/releaser/workflow"
+	"gopkg.in/yaml.v3"
+)
+
+// TokenEnv is the environment variable holding the GitHub access token.
+const TokenEnv = "GITHUB_TOKEN"
+
+// FileEnv is the environment variable holding the path of the config file.
+const FileEnv = "RELEASER_CONFIG"
+
+// Config is the effective configuration of the releaser.
+type Config struct {
+	Owner  string `yaml:"owner"`
+	Repo   string `yaml:"repo"`
+	Branch string `yaml:"branch"`
+	GitDir string `yaml:"git_dir"`
+	// Discovery is "git", "api" or empty; see workflow.Options.
+	Discovery string `yaml:"discovery"`
+	DryRun    bool   `yaml:"dry_run"`
+	// StateDir is the directory the progress of releases is persisted in.
+	StateDir string `yaml:"state_dir"`
+
+	RequiredChecks    []string `yaml:"required_checks,flow"`
+	TagPrefix         string   `yaml:"tag_prefix"`
+	MajorVersions     []int    `yaml:"major_versions,flow"`
+	ReleaseNameFilter string   `yaml:"release_name_filter"`
+	PolicyFile        string   `yaml:"policy_file"`
+	AllowMajor        bool     `yaml:"allow_major"`
+	PreRelease        string   `yaml:"prerelease"`
+
+	// Strict aborts releases if pull requests are missing a ChangeLog entry.
+	Strict bool `yaml:"strict"`
+	// Remind comments on pull requests missing a ChangeLog entry.
+	Remind bool `yaml:"remind"`
+
+	// Concurrency is the number of pull requests fetched at the same time.
+	Concurrency int `yaml:"concurrency"`
+	// Fetcher is "rest", "graphql" or empty; see workflow.Options.
+	Fetcher string `yaml:"fetcher"`
+	// CacheDir is the directory pull requests are cached in.
+	CacheDir string `yaml:"cache_dir"`
+
+	// AppID, AppInstallationID and AppPrivateKeyFile authenticate as a
+	// GitHub App installation instead of with the access token.
+	AppID             int64  `yaml:"app_id"`
+	AppInstallationID int64  `yaml:"app_installation_id"`
+	AppPrivateKeyFile string `yaml:"app_private_key_file"`
+	// BaseURL and UploadURL are the GitHub Enterprise API URLs.
+	BaseURL   string `yaml:"base_url"`
+	UploadURL string `yaml:"upload_url"`
+
+	// RecordDir is the directory GitHub API traffic is recorded to.
+	RecordDir string `yaml:"record_dir"`
+	// ReplayDir is a directory written by RecordDir, which is served
+	// instead of accessing GitHub.
+	ReplayDir string `yaml:"replay_dir"`
+
+	// AccessToken is read from the environment only.
+	AccessToken string `yaml:"-"`
+}
+
+// Default returns the configuration used for collectd, before a config file,
+// environment variables and flags are applied.
+func Default() Config {
+	return Config{
+		Owner:         "collectd",
+		Repo:          "collectd",
+		DryRun:        true,
+		StateDir:      ".releaser",
+		TagPrefix:     "collectd-",
+		MajorVersions: []int{6},
+		Concurrency:   workflow.DefaultConcurrency,
+		CacheDir:      filepath.Join(".releaser", "cache"),
+	}
+}
+
+// FlagGroup is a set of settings used together. Commands register the flags
+// of the groups they use.
+type FlagGroup int
+
+const (
+	// GitHubFlags select the repository and branch and how GitHub is
+	// accessed.
+	GitHubFlags FlagGroup = 1 << iota
+	// ChecksFlags configure the checks that must succeed.
+	ChecksFlags
+	// HistoryFlags configure how releases and pull requests are found.
+	HistoryFlags
+	// PolicyFlags configure how pull requests are classified.
+	PolicyFlags
+	// VersionFlags configure how the next version is chosen.
+	VersionFlags
+	// ReleaseFlags configure how releases are made.
+	ReleaseFlags
+
+	// AllFlags are all groups.
+	AllFlags = GitHubFlags | ChecksFlags | HistoryFlags | PolicyFlags | VersionFlags | ReleaseFlags
+)
+
+// setting is a configuration option that can be set by an environment
+// variable and a flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, s string) error
+	bool  bool
+	group FlagGroup
+}
+
+var settings = []setting{
+	{flag: "owner", env: "RELEASER_OWNER", usage: "owner of the GitHub repository", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.Owner = s; return nil }},
+	{flag: "repo", env: "RELEASER_REPO", usage: "name of the GitHub repository", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.Repo = s; return nil }},
+	{flag: "branch", env: "RELEASER_BRANCH", usage: "branch to release from", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.Branch = s; return nil }},
+	{flag: "git-dir", env: "RELEASER_GIT_DIR", usage: "path of the \".git\" directory of a local clone", group: HistoryFlags,
+		set: func(c *Config, s string) error { c.GitDir = s; return nil }},
+	{flag: "discovery", env: "RELEASER_DISCOVERY", usage: "how merged pull requests are found: \"git\" or \"api\"; \"git\" if -git-dir is set", group: HistoryFlags,
+		set: func(c *Config, s string) error { c.Discovery = s; return nil }},
+	{flag: "dryrun", env: "RELEASER_DRY_RUN", usage: "controls whether changes are made upstream", bool: true, group: ReleaseFlags,
+		set: func(c *Config, s string) (err error) { c.DryRun, err = strconv.ParseBool(s); return err }},
+	{flag: "state-dir", env: "RELEASER_STATE_DIR", usage: "directory in which the progress of releases is persisted; disabled if empty", group: ReleaseFlags,
+		set: func(c *Config, s string) error { c.StateDir = s; return nil }},
+	{flag: "required-checks", env: "RELEASER_REQUIRED_CHECKS", usage: "comma separated list of status contexts and check runs that must succeed; all reported, and at least one, if empty", group: ChecksFlags,
+		set: func(c *Config, s string) error { c.RequiredChecks = splitList(s); return nil }},
+	{flag: "tag-prefix", env: "RELEASER_TAG_PREFIX", usage: "part of the tag name preceding the version number; \"collectd-\" if empty", group: HistoryFlags,
+		set: func(c *Config, s string) error { c.TagPrefix = s; return nil }},
+	{flag: "major-versions", env: "RELEASER_MAJOR_VERSIONS", usage: "comma separated list of major versions to consider; all if empty", group: HistoryFlags,
+		set: func(c *Config, s string) error {
+			c.MajorVersions = nil
+			for _, f := range splitList(s) {
+				major, err := strconv.Atoi(f)
+				if err != nil {
+					return err
+				}
+				c.MajorVersions = append(c.MajorVersions, major)
+			}
+			return nil
+		}},
+	{flag: "release-name", env: "RELEASER_RELEASE_NAME_FILTER", usage: "regular expression release names have to match; all if empty", group: HistoryFlags,
+		set: func(c *Config, s string) error { c.ReleaseNameFilter = s; return nil }},
+	{flag: "policy", env: "RELEASER_POLICY_FILE", usage: "YAML file mapping labels to version bumps and ChangeLog categories", group: PolicyFlags,
+		set: func(c *Config, s string) error { c.PolicyFile = s; return nil }},
+	{flag: "allow-major", env: "RELEASER_ALLOW_MAJOR", usage: "confirms that the major version may be incremented", bool: true, group: VersionFlags,
+		set: func(c *Config, s string) (err error) { c.AllowMajor, err = strconv.ParseBool(s); return err }},
+	{flag: "prerelease", env: "RELEASER_PRERELEASE", usage: "suffix of release candidates; final releases are created directly if empty", group: VersionFlags,
+		set: func(c *Config, s string) error { c.PreRelease = s; return nil }},
+	{flag: "strict", env: "RELEASER_STRICT", usage: "abort the release if pull requests requiring a version bump have no ChangeLog entry", bool: true, group: ReleaseFlags,
+		set: func(c *Config, s string) (err error) { c.Strict, err = strconv.ParseBool(s); return err }},
+	{flag: "remind", env: "RELEASER_REMIND", usage: "comment on pull requests requiring a version bump that have no ChangeLog entry", bool: true, group: ReleaseFlags,
+		set: func(c *Config, s string) (err error) { c.Remind, err = strconv.ParseBool(s); return err }},
+	{flag: "concurrency", env: "RELEASER_CONCURRENCY", usage: "number of pull requests fetched at the same time", group: HistoryFlags,
+		set: func(c *Config, s string) (err error) { c.Concurrency, err = strconv.Atoi(s); return err }},
+	{flag: "fetcher", env: "RELEASER_FETCHER", usage: "how pull requests are fetched: \"rest\" or \"graphql\"", group: HistoryFlags,
+		set: func(c *Config, s string) error { c.Fetcher = s; return nil }},
+	{flag: "cache-dir", env: "RELEASER_CACHE_DIR", usage: "directory pull requests are cached in; disabled if empty", group: HistoryFlags,
+		set: func(c *Config, s string) error { c.CacheDir = s; return nil }},
+	{flag: "app-id", env: "RELEASER_APP_ID", usage: "ID of the GitHub App to authenticate as, instead of using $" + TokenEnv, group: GitHubFlags,
+		set: func(c *Config, s string) (err error) { c.AppID, err = strconv.ParseInt(s, 10, 64); return err }},
+	{flag: "app-installation-id", env: "RELEASER_APP_INSTALLATION_ID", usage: "ID of the GitHub App installation", group: GitHubFlags,
+		set: func(c *Config, s string) (err error) {
+			c.AppInstallationID, err = strconv.ParseInt(s, 10, 64)
+			return err
+		}},
+	{flag: "app-private-key", env: "RELEASER_APP_PRIVATE_KEY_FILE", usage: "PEM file holding the private key of the GitHub App", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.AppPrivateKeyFile = s; return nil }},
+	{flag: "base-url", env: "RELEASER_BASE_URL", usage: "GitHub API base URL, e.g. \"https://github.example.com/api/v3/\" for GitHub Enterprise", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.BaseURL = s; return nil }},
+	{flag: "upload-url", env: "RELEASER_UPLOAD_URL", usage: "GitHub upload URL; derived from -base-url if empty", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.UploadURL = s; return nil }},
+	{flag: "record", env: "RELEASER_RECORD_DIR", usage: "directory to record the GitHub API traffic to, with credentials redacted", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.RecordDir = s; return nil }},
+	{flag: "replay", env: "RELEASER_REPLAY_DIR", usage: "directory written by -record to serve instead of accessing GitHub", group: GitHubFlags,
+		set: func(c *Config, s string) error { c.ReplayDir = s; return nil }},
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// Flags records the configuration flags given on the command line. They are
+// applied by Load after the config file and the environment.
+type Flags struct {
+	path   string
+	values map[string]string
+}
+
+type flagValue struct {
+	flags *Flags
+	s     setting
+}
+
+func (v flagValue) String() string {
+	if v.flags == nil {
+		return ""
+	}
+	return v.flags.values[v.s.flag]
+}
+
+func (v flagValue) Set(s string) error {
+	// Check the value early so that flag.Parse reports the error.
+	var c Config
+	if err := v.s.set(&c, s); err != nil {
+		return err
+	}
+	v.flags.values[v.s.flag] = s
+	return nil
+}
+
+func (v flagValue) IsBoolFlag() bool {
+	return v.s.bool
+}
+
+// RegisterFlags registers the "-config" flag and a flag for each setting in
+// groups with fs.
+func RegisterFlags(fs *flag.FlagSet, groups FlagGroup) *Flags {
+	f := &Flags{
+		values: make(map[string]string),
+	}
+
+	fs.StringVar(&f.path, "config", "", fmt.Sprintf("path of the YAML config file; overrides $%s", FileEnv))
+	for _, s := range settings {
+		if s.group&groups == 0 {
+			continue
+		}
+		fs.Var(flagValue{flags: f, s: s}, s.flag, fmt.Sprintf("%s ($%s)", s.usage, s.env))
+	}
+
+	return f
+}
+
+// Load returns the effective configuration: the defaults, overridden by the
+// config file, the environment variables and the flags, in this order. The
+// config file is read from the "-config" flag or $RELEASER_CONFIG. getenv is
+// usually os.Getenv.
+//
+// Invalid settings are skipped and reported together in the returned error,
+// so that the returned configuration can still be validated and printed.
+func Load(flags *Flags, getenv func(string) string) (Config, error) {
+	c := Default()
+	var errs []error
+
+	path := getenv(FileEnv)
+	if flags != nil && flags.path != "" {
+		path = flags.path
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = c.parse(data)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+
+	for _, s := range settings {
+		v := getenv(s.env)
+		if v == "" {
+			continue
+		}
+		if err := s.set(&c, v); err != nil {
+			errs = append(errs, fmt.Errorf("$%s: %w", s.env, err))
+		}
+	}
+	c.AccessToken = getenv(TokenEnv)
+
+	if flags != nil {
+		for _, s := range settings {
+			v, ok := flags.values[s.flag]
+			if !ok {
+				continue
+			}
+			if err := s.set(&c, v); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag, err))
+			}
+		}
+	}
+
+	return c, errors.Join(errs...)
+}
+
+func (c *Config) parse(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	err := dec.Decode(c)
+	if errors.Is(err, io.EOF) {
+		// empty file
+		return nil
+	}
+	return err
+}
+
+// Validate reports all problems with the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	for _, f := range []struct {
+		name, value string
+	}{
+		{"owner", c.Owner},
+		{"repo", c.Repo},
+		{"branch", c.Branch},
+	} {
+		if f.value == "" {
+			errs = append(errs, fmt.Errorf("%s is not set", f.name))
+		}
+	}
+
+	switch c.Discovery {
+	case "", "api":
+	case "git":
+		if c.GitDir == "" {
+			errs = append(errs, errors.New("git_dir is not set, but required by discovery \"git\""))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("discovery: got %q, want \"git\" or \"api\"", c.Discovery))
+	}
+
+	app := c.AppID != 0 || c.AppInstallationID != 0 || c.AppPrivateKeyFile != ""
+	switch {
+	case app:
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"app_id", c.AppID > 0},
+			{"app_installation_id", c.AppInstallationID > 0},
+			{"app_private_key_file", c.AppPrivateKeyFile != ""},
+		} {
+			if !f.set {
+				errs = append(errs, fmt.Errorf("%s is not set, but required for GitHub App authentication", f.name))
+			}
+		}
+		if c.AppPrivateKeyFile != "" {
+			if _, err := os.Stat(c.AppPrivateKeyFile); err != nil {
+				errs = append(errs, fmt.Errorf("app_private_key_file: %w", err))
+			}
+		}
+	case c.AccessToken == "" && c.ReplayDir == "":
+		errs = append(errs, fmt.Errorf("the environment variable %q is empty or unset", TokenEnv))
+	}
+
+	for _, f := range []struct {
+		name, value string
+	}{
+		{"base_url", c.BaseURL},
+		{"upload_url", c.UploadURL},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if u, err := url.Parse(f.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("%s: got %q, want an http or https URL", f.name, f.value))
+		}
+	}
+	if c.UploadURL != "" && c.BaseURL == "" {
+		errs = append(errs, errors.New("upload_url requires base_url"))
+	}
+
+	switch c.Fetcher {
+	case "", "rest", "graphql":
+	default:
+		errs = append(errs, fmt.Errorf("fetcher: got %q, want \"rest\" or \"graphql\"", c.Fetcher))
+	}
+
+	if c.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("concurrency: got %d, want a positive number", c.Concurrency))
+	}
+
+	if c.RecordDir != "" && c.ReplayDir != "" {
+		errs = append(errs, errors.New("record_dir and replay_dir are mutually exclusive"))
+	}
+
+	for _, m := range c.MajorVersions {
+		if m < 0 {
+			errs = append(errs, fmt.Errorf("major_versions: invalid major version %d", m))
+		}
+	}
+
+	if _, err := regexp.Compile(c.ReleaseNameFilter); err != nil {
+		errs = append(errs, fmt.Errorf("release_name_filter: %w", err))
+	}
+
+	if strings.ContainsAny(c.PreRelease, "0123456789") {
+		errs = append(errs, fmt.Errorf("prerelease: suffix %q must not contain digits", c.PreRelease))
+	}
+
+	if c.PolicyFile != "" {
+		if _, err := policy.Load(c.PolicyFile); err != nil {
+			errs = append(errs, fmt.Errorf("policy_file: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Options converts the configuration to workflow options. The configuration
+// should have been validated.
+func (c Config) Options() (workflow.Options, error) {
+	opts := workflow.Options{
+		Owner:             c.Owner,
+		Repo:              c.Repo,
+		Branch:            c.Branch,
+		AccessToken:       c.AccessToken,
+		GitDir:            c.GitDir,
+		Discovery:         c.Discovery,
+		DryRun:            c.DryRun,
+		StateDir:          c.StateDir,
+		RequiredChecks:    c.RequiredChecks,
+		TagPrefix:         c.TagPrefix,
+		MajorVersions:     c.MajorVersions,
+		AllowMajor:        c.AllowMajor,
+		PreRelease:        c.PreRelease,
+		StrictChangeLog:   c.Strict,
+		RemindChangeLog:   c.Remind,
+		Concurrency:       c.Concurrency,
+		Fetcher:           c.Fetcher,
+		CacheDir:          c.CacheDir,
+		AppID:             c.AppID,
+		AppInstallationID: c.AppInstallationID,
+		AppPrivateKeyFile: c.AppPrivateKeyFile,
+		BaseURL:           c.BaseURL,
+		UploadURL:         c.UploadURL,
+		RecordDir:         c.RecordDir,
+		ReplayDir:         c.ReplayDir,
+	}
+
+	if c.ReleaseNameFilter != "" {
+		re, err := regexp.Compile(c.ReleaseNameFilter)
+		if err != nil {
+			return workflow.Options{}, fmt.Errorf("release_name_filter: %w", err)
+		}
+		opts.ReleaseNameFilter = re
+	}
+
+	if c.PolicyFile != "" {
+		p, err := policy.Load(c.PolicyFile)
+		if err != nil {
+			return workflow.Options{}, fmt.Errorf("policy_file: %w", err)
+		}
+		opts.Policy = p
+	}
+
+	return opts, nil
+}
+
+// String returns the configuration in the config file format. The access
+// token is not included.
+func (c Config) String() string {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return fmt.Sprintf("# %v\n", err)
+	}
+	enc.Close()
+
+	if c.AccessToken != "" {
+		fmt.Fprintf(&b, "# access token: set via $%s (redacted)\n", TokenEnv)
+	} else {
+		fmt.Fprintf(&b, "# access token: not set, set $%s\n", TokenEnv)
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "releaser.yaml")
+	if err := os.WriteFile(path, []byte(`owner: octo
+repo: example
+branch: from-file
+git_dir: /tmp/example/.git
+major_versions: [5, 6]
+prerelease: .rc
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		FileEnv:           path,
+		TokenEnv:          "secret",
+		"RELEASER_BRANCH": "from-env",
+		"RELEASER_REPO":   "other",
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs, AllFlags)
+	if err := fs.Parse([]string{"-branch", "from-flag", "-dryrun=false", "-required-checks", "build, test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(flags, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.Owner = "octo"
+	want.Repo = "other"
+	want.Branch = "from-flag"
+	want.GitDir = "/tmp/example/.git"
+	want.MajorVersions = []int{5, 6}
+	want.PreRelease = ".rc"
+	want.DryRun = false
+	want.RequiredChecks = []string{"build", "test"}
+	want.AccessToken = "secret"
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Load() differs (-want/+got):\n%s", diff)
+	}
+
+	if err := got.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if strings.Contains(got.String(), "secret") {
+		t.Errorf("String() contains the access token:\n%s", got)
+	}
+}
+
+func TestRegisterFlagGroups(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs, GitHubFlags|ChecksFlags)
+
+	for _, name := range []string{"config", "owner", "branch", "required-checks"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("flag -%s is not registered", name)
+		}
+	}
+	for _, name := range []string{"git-dir", "policy", "prerelease", "dryrun"} {
+		if fs.Lookup(name) != nil {
+			t.Errorf("flag -%s is registered, want only GitHub and checks flags", name)
+		}
+	}
+
+	for _, s := range settings {
+		if s.group == 0 {
+			t.Errorf("setting %q belongs to no flag group", s.flag)
+		}
+	}
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "releaser.yaml")
+	if err := os.WriteFile(path, []byte("ownr: octo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(nil, func(k string) string {
+		if k == FileEnv {
+			return path
+		}
+		return ""
+	}); err == nil {
+		t.Error("Load() succeeded, want error for unknown key")
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	c := Default()
+	c.ReleaseNameFilter = "("
+	c.PreRelease = "-rc1"
+	c.MajorVersions = []int{-1}
+	c.Discovery = "git"
+	c.Fetcher = "soap"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate() succeeded, want error")
+	}
+
+	for _, want := range []string{"branch", "git_dir", TokenEnv, "major_versions", "release_name_filter", "prerelease", "fetcher"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %q, want mention of %q", err, want)
+		}
+	}
+}
+
+func TestValidateDiscovery(t *testing.T) {
+	for _, tc := range []struct {
+		discovery string
+		gitDir    string
+		wantErr   bool
+	}{
+		{discovery: ""},
+		{discovery: "api"},
+		{discovery: "git", gitDir: "/tmp/example/.git"},
+		{discovery: "git", wantErr: true},
+		{discovery: "svn", wantErr: true},
+	} {
+		c := Default()
+		c.Branch = "main"
+		c.AccessToken = "secret"
+		c.Discovery = tc.discovery
+		c.GitDir = tc.gitDir
+
+		if err := c.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("Validate(discovery=%q, git_dir=%q) = %v, want error %v", tc.discovery, tc.gitDir, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	c := Default()
+	c.Branch = "main"
+	c.ReplayDir = "testdata/replay"
+
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want no error: replaying requires no access token", err)
+	}
+
+	c.RecordDir = "testdata/record"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("Validate() = %v, want error about record_dir and replay_dir", err)
+	}
+}
+
+func TestValidateApp(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	if err := os.WriteFile(keyFile, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Default()
+	c.Branch = "main"
+	c.AppID = 7
+	c.AppInstallationID = 42
+	c.AppPrivateKeyFile = keyFile
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want no error: GitHub Apps require no access token", err)
+	}
+
+	c.AppInstallationID = 0
+	c.UploadURL = "https://uploads.example.com/"
+	err := c.Validate()
+	for _, want := range []string{"app_installation_id", "upload_url requires base_url"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want mention of %q", err, want)
+		}
+	}
+}
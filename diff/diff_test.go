@@ -0,0 +1,89 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnified(t *testing.T) {
+	cases := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "prepend",
+			old:  "1\n2\n3\n4\n5\n",
+			new:  "new\n\n1\n2\n3\n4\n5\n",
+			want: "--- a/f\n+++ b/f\n" +
+				"@@ -1,3 +1,5 @@\n" +
+				"+new\n" +
+				"+\n" +
+				" 1\n" +
+				" 2\n" +
+				" 3\n",
+		},
+		{
+			name: "two hunks",
+			old:  strings.Repeat("x\n", 3) + "a\n" + strings.Repeat("y\n", 10) + "b\n",
+			new:  strings.Repeat("x\n", 3) + "A\n" + strings.Repeat("y\n", 10) + "B\n",
+			want: "--- a/f\n+++ b/f\n" +
+				"@@ -1,7 +1,7 @@\n" +
+				" x\n x\n x\n" +
+				"-a\n" +
+				"+A\n" +
+				" y\n y\n y\n" +
+				"@@ -12,4 +12,4 @@\n" +
+				" y\n y\n y\n" +
+				"-b\n" +
+				"+B\n",
+		},
+		{
+			name: "merged hunks",
+			old:  "a\n1\n2\n3\n4\nb\n",
+			new:  "A\n1\n2\n3\n4\nB\n",
+			want: "--- a/f\n+++ b/f\n" +
+				"@@ -1,6 +1,6 @@\n" +
+				"-a\n" +
+				"+A\n" +
+				" 1\n 2\n 3\n 4\n" +
+				"-b\n" +
+				"+B\n",
+		},
+		{
+			name: "new file",
+			old:  "",
+			new:  "a\n",
+			want: "--- a/f\n+++ b/f\n" +
+				"@@ -0,0 +1 @@\n" +
+				"+a\n",
+		},
+		{
+			name: "missing newline",
+			old:  "a\nb",
+			new:  "a\nc",
+			want: "--- a/f\n+++ b/f\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" a\n" +
+				"-b\n\\ No newline at end of file\n" +
+				"+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Unified("a/f", "b/f", []byte(tc.old), []byte(tc.new))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unified() differs (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -2,43 +2,162 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/collectd/releaser/config"
 	"github.com/collectd/releaser/workflow"
 )
 
-const (
-	owner = "collectd"
-	repo  = "collectd"
-)
+// command is a subcommand of the releaser binary.
+type command struct {
+	name string
+	// args describes the positional arguments, e.g. "[file]".
+	args string
+	// help is a one line description of the command.
+	help string
+	// flags are the configuration flags the command accepts.
+	flags config.FlagGroup
+	run   func(ctx context.Context, name string, args []string) error
+}
 
-var (
-	dryRun = flag.Bool("dryrun", true, "controls whether changes are made upstream")
-)
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "status", help: "show the checks on the branch head",
+			flags: config.GitHubFlags | config.ChecksFlags, run: runStatus},
+		{name: "prs", help: "list the pull requests merged since the last release and their classification",
+			flags: config.GitHubFlags | config.HistoryFlags | config.PolicyFlags, run: runPRs},
+		{name: "next-version", help: "show the next version and the reason for it",
+			flags: config.GitHubFlags | config.HistoryFlags | config.PolicyFlags | config.VersionFlags, run: runNextVersion},
+		{name: "changelog", help: "render the ChangeLog of the next release",
+			flags: config.GitHubFlags | config.HistoryFlags | config.PolicyFlags | config.VersionFlags, run: runChangeLog},
+		{name: "plan", args: "[file]", help: "show all changes the next release will make, optionally saving the plan to file",
+			flags: config.AllFlags, run: runPlan},
+		{name: "apply", args: "<file>", help: "execute a plan saved by \"plan\"",
+			flags: config.AllFlags, run: runApply},
+		{name: "release", help: "create the next release or resume an interrupted one",
+			flags: config.AllFlags, run: runRelease},
+		{name: "promote", args: "[tag]", help: "promote a release candidate, by default the latest, to a final release",
+			flags: config.GitHubFlags | config.HistoryFlags | config.PolicyFlags | config.ReleaseFlags, run: runPromote},
+		{name: "config", args: "print", help: "show the effective configuration",
+			flags: config.AllFlags, run: runConfig},
+	}
+}
 
-const tokenEnv = "GITHUB_TOKEN"
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s <command> [flags] [args]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-13s %s\n", c.name, c.help)
+	}
+	fmt.Fprintf(out, "\nRun \"%s <command> -help\" for the flags of a command.\n", os.Args[0])
+}
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 	ctx := context.Background()
 
-	opts := workflow.Options{
-		Owner:       owner,
-		Repo:        repo,
-		Branch:      "collectd-6.0",
-		AccessToken: os.Getenv(tokenEnv),
-		GitDir:      "/home/octo/collectd/.git",
-		DryRun:      *dryRun,
+	if flag.NArg() == 0 || flag.Arg(0) == "help" {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != flag.Arg(0) {
+			continue
+		}
+		err := c.run(ctx, c.name, flag.Args()[1:])
+		if releaser != nil {
+			if u := releaser.APIUsage(); len(u.Calls) != 0 {
+				log.Print(u)
+			}
+			if unused := releaser.UnusedInteractions(); len(unused) != 0 {
+				log.Printf("Warning: %d recorded interaction(s) have not been replayed:\n%s", len(unused), strings.Join(unused, "\n"))
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n\n", flag.Arg(0))
+	usage()
+	os.Exit(2)
+}
+
+// commandFlags returns a flag set for the named command. It includes the
+// configuration flags the command uses and the "-json" flag, if jsonOut is not
+// nil.
+func commandFlags(name string, jsonOut *bool) (*flag.FlagSet, *config.Flags) {
+	var c command
+	for _, cmd := range commands {
+		if cmd.name == name {
+			c = cmd
+		}
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	cfgFlags := config.RegisterFlags(fs, c.flags)
+	if jsonOut != nil {
+		fs.BoolVar(jsonOut, "json", false, "print machine-readable JSON")
+	}
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", os.Args[0], c.name, c.args, c.help)
+		fs.PrintDefaults()
 	}
 
-	if opts.AccessToken == "" {
-		log.Fatalf("The environment variable %q is empty or unset", tokenEnv)
+	return fs, cfgFlags
+}
+
+// loadConfig returns the effective, validated configuration.
+func loadConfig(cfgFlags *config.Flags) (config.Config, error) {
+	cfg, err := config.Load(cfgFlags, os.Getenv)
+	if err := errors.Join(err, cfg.Validate()); err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
 	}
+	return cfg, nil
+}
 
-	wf := workflow.New(ctx, opts)
-	if err := wf.Run(ctx); err != nil {
-		log.Fatal(err)
+// releaser is the releaser created by newReleaser, if any. Its API usage is
+// reported when the command exits.
+var releaser *workflow.Releaser
+
+// newReleaser parses args with fs and returns the configured releaser.
+func newReleaser(ctx context.Context, fs *flag.FlagSet, cfgFlags *config.Flags, args []string) (*workflow.Releaser, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
 	}
+
+	cfg, err := loadConfig(cfgFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	wf, err := workflow.New(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	releaser = wf
+	return wf, nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
 }
@@ -0,0 +1,256 @@
+// Package policy maps pull request labels to version bumps and ChangeLog
+// categories.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/collectd/releaser/changelog"
+	"github.com/collectd/releaser/version"
+	"gopkg.in/yaml.v3"
+)
+
+// Label describes the effect of a single pull request label.
+type Label struct {
+	// Bump is the version bump required by pull requests with this label.
+	Bump version.Bump `yaml:"bump"`
+	// Category is the ChangeLog category of pull requests with this label.
+	// Optional.
+	Category string `yaml:"category,omitempty"`
+}
+
+// Policy is the table of labels with a meaning to the releaser.
+type Policy struct {
+	// Classifier selects whether labels, Conventional Commits titles or
+	// both determine the version bump. Defaults to labels.
+	Classifier version.Classifier `yaml:"classifier,omitempty"`
+	Labels     map[string]Label   `yaml:"labels"`
+	// Order lists the ChangeLog categories sorted to the front, in order.
+	Order []string `yaml:"order,omitempty"`
+	// ScopeCategories uses the scope of Conventional Commits titles as
+	// ChangeLog category of pull requests without a category label.
+	ScopeCategories bool `yaml:"scope_categories,omitempty"`
+	// Sections lists the titled sections of the ChangeLog, in order. If
+	// empty, entries are not grouped into sections.
+	Sections []Section `yaml:"sections,omitempty"`
+	// Kinds lists the ChangeLog categories that order the entries of each
+	// plugin within their section, e.g. features before fixes, without
+	// selecting the section.
+	Kinds []string `yaml:"kinds,omitempty"`
+	// Prefixes maps the prefix of ChangeLog entries, e.g. "Build system" in
+	// "Build system: Text.", to their category.
+	Prefixes map[string]string `yaml:"prefixes,omitempty"`
+}
+
+// Section is a titled group of ChangeLog entries.
+type Section struct {
+	Title string `yaml:"title"`
+	// Categories lists the ChangeLog categories in this section. A section
+	// without categories holds all entries not in any other section.
+	Categories []string `yaml:"categories,omitempty"`
+}
+
+// Default is the policy used by collectd. Its ChangeLog settings are those of
+// changelog.DefaultPolicy.
+var Default = fromChangeLog(changelog.DefaultPolicy, map[string]version.Bump{
+	"Breaking": version.BumpMajor,
+	"Feature":  version.BumpMinor,
+	"Fix":      version.BumpPatch,
+	"core":     version.BumpNone,
+})
+
+// Load reads and validates the policy stored in the YAML file at path.
+func Load(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates a YAML encoded policy, for example:
+//
+//	labels:
+//	  Breaking: {bump: major, category: breaking}
+//	  Feature:  {bump: minor}
+//	  Fix:      {bump: patch}
+//	  core:     {bump: none, category: core}
+//	order: [breaking, core]
+//	sections:
+//	  - {title: Breaking changes, categories: [breaking]}
+//	  - {title: Core, categories: [core]}
+//	  - {title: Plugins}
+//	kinds: [features, fixes]
+//	prefixes:
+//	  Build system: build
+//
+// The optional "classifier" key selects "labels", "conventional" or "hybrid"
+// classification of pull requests.
+func Parse(data []byte) (Policy, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return Policy{}, err
+	}
+
+	if err := p.Validate(); err != nil {
+		return Policy{}, err
+	}
+	return p, nil
+}
+
+// Validate reports all problems with the policy at once.
+func (p Policy) Validate() error {
+	var errs []error
+
+	if len(p.Labels) == 0 {
+		errs = append(errs, errors.New("no labels defined"))
+	}
+
+	categories := make(map[string]bool)
+	for _, name := range p.LabelNames() {
+		l := p.Labels[name]
+		if name == "" {
+			errs = append(errs, errors.New("empty label name"))
+		}
+		if l.Bump < version.BumpNone || l.Bump > version.BumpMajor {
+			errs = append(errs, fmt.Errorf("label %q: invalid bump %v", name, l.Bump))
+		}
+		if l.Category != "" {
+			categories[l.Category] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range p.Order {
+		if seen[c] {
+			errs = append(errs, fmt.Errorf("order: category %q is listed more than once", c))
+		}
+		seen[c] = true
+
+		if !categories[c] && !p.ScopeCategories {
+			errs = append(errs, fmt.Errorf("order: category %q is not used by any label", c))
+		}
+	}
+
+	titles := make(map[string]bool)
+	sectionOf := make(map[string]string)
+	catchAll := ""
+	for i, s := range p.Sections {
+		if s.Title == "" {
+			errs = append(errs, fmt.Errorf("sections[%d]: empty title", i))
+		} else if titles[s.Title] {
+			errs = append(errs, fmt.Errorf("sections: title %q is listed more than once", s.Title))
+		}
+		titles[s.Title] = true
+
+		if len(s.Categories) == 0 {
+			if catchAll != "" {
+				errs = append(errs, fmt.Errorf("sections: %q and %q both have no categories", catchAll, s.Title))
+			}
+			catchAll = s.Title
+		}
+		for _, c := range s.Categories {
+			if prev, ok := sectionOf[c]; ok {
+				errs = append(errs, fmt.Errorf("sections: category %q is listed in %q and %q", c, prev, s.Title))
+				continue
+			}
+			sectionOf[c] = s.Title
+		}
+	}
+
+	kinds := make(map[string]bool)
+	for _, c := range p.Kinds {
+		if kinds[c] {
+			errs = append(errs, fmt.Errorf("kinds: category %q is listed more than once", c))
+		}
+		kinds[c] = true
+
+		if s, ok := sectionOf[c]; ok {
+			errs = append(errs, fmt.Errorf("kinds: category %q is also listed in section %q", c, s))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LabelNames returns the sorted names of all labels referenced by the policy.
+func (p Policy) LabelNames() []string {
+	var ret []string
+	for name := range p.Labels {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Bumps returns the label table used by version.Policy.
+func (p Policy) Bumps() map[string]version.Bump {
+	ret := make(map[string]version.Bump)
+	for name, l := range p.Labels {
+		ret[name] = l.Bump
+	}
+	return ret
+}
+
+// ChangeLog returns the policy used to create ChangeLog entries.
+func (p Policy) ChangeLog() changelog.Policy {
+	ret := changelog.Policy{
+		Categories:      make(map[string]string),
+		Order:           p.Order,
+		ScopeCategories: p.ScopeCategories,
+		Kinds:           p.Kinds,
+		Prefixes:        p.Prefixes,
+		Plugins:         changelog.KnownPlugins,
+	}
+	for _, s := range p.Sections {
+		ret.Sections = append(ret.Sections, changelog.Section{
+			Title:      s.Title,
+			Categories: s.Categories,
+		})
+	}
+	for name, l := range p.Labels {
+		if l.Category != "" {
+			ret.Categories[name] = l.Category
+		}
+	}
+	return ret
+}
+
+// fromChangeLog returns the policy with the label bumps in bumps and the
+// ChangeLog settings of cl. It is the inverse of Policy.ChangeLog.
+func fromChangeLog(cl changelog.Policy, bumps map[string]version.Bump) Policy {
+	ret := Policy{
+		Labels:          make(map[string]Label),
+		Order:           cl.Order,
+		ScopeCategories: cl.ScopeCategories,
+		Kinds:           cl.Kinds,
+		Prefixes:        cl.Prefixes,
+	}
+	for _, s := range cl.Sections {
+		ret.Sections = append(ret.Sections, Section{
+			Title:      s.Title,
+			Categories: s.Categories,
+		})
+	}
+	for name, b := range bumps {
+		ret.Labels[name] = Label{Bump: b, Category: cl.Categories[name]}
+	}
+	for name, c := range cl.Categories {
+		if _, ok := bumps[name]; !ok {
+			ret.Labels[name] = Label{Bump: version.BumpNone, Category: c}
+		}
+	}
+	return ret
+}
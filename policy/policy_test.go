@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/collectd/releaser/changelog"
+	"github.com/collectd/releaser/version"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: `labels:
+  Breaking: {bump: major, category: breaking}
+  Feature: {bump: minor}
+  Fix: {bump: patch}
+  core: {bump: none, category: core}
+order: [breaking, core]
+`,
+			want: Policy{
+				Labels: map[string]Label{
+					"Breaking": {Bump: version.BumpMajor, Category: "breaking"},
+					"Feature":  {Bump: version.BumpMinor},
+					"Fix":      {Bump: version.BumpPatch},
+					"core":     {Bump: version.BumpNone, Category: "core"},
+				},
+				Order: []string{"breaking", "core"},
+			},
+		},
+		{
+			name: "conventional commits",
+			data: `classifier: hybrid
+labels:
+  Fix: {bump: patch}
+order: [cpu]
+scope_categories: true
+`,
+			want: Policy{
+				Classifier: version.ClassifyHybrid,
+				Labels: map[string]Label{
+					"Fix": {Bump: version.BumpPatch},
+				},
+				Order:           []string{"cpu"},
+				ScopeCategories: true,
+			},
+		},
+		{
+			name: "sections",
+			data: `labels:
+  Feature: {bump: minor, category: features}
+  core: {bump: none, category: core}
+sections:
+  - {title: Core, categories: [core]}
+  - {title: Plugins}
+  - {title: Build, categories: [build]}
+kinds: [features]
+prefixes: {Build system: build}
+`,
+			want: Policy{
+				Labels: map[string]Label{
+					"Feature": {Bump: version.BumpMinor, Category: "features"},
+					"core":    {Bump: version.BumpNone, Category: "core"},
+				},
+				Sections: []Section{
+					{Title: "Core", Categories: []string{"core"}},
+					{Title: "Plugins"},
+					{Title: "Build", Categories: []string{"build"}},
+				},
+				Kinds:    []string{"features"},
+				Prefixes: map[string]string{"Build system": "build"},
+			},
+		},
+		{
+			name:    "invalid classifier",
+			data:    "classifier: magic\nlabels:\n  Fix: {bump: patch}\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid bump",
+			data:    "labels:\n  Feature: {bump: huge}\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    "labels:\n  Feature: {bump: minor, colour: red}\n",
+			wantErr: true,
+		},
+		{
+			name:    "no labels",
+			data:    "order: []\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown category in order",
+			data:    "labels:\n  Feature: {bump: minor, category: features}\norder: [features, plugins]\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate category in order",
+			data:    "labels:\n  Feature: {bump: minor, category: features}\norder: [features, features]\n",
+			wantErr: true,
+		},
+		{
+			name:    "kind listed in a section",
+			data:    "labels:\n  Fix: {bump: patch, category: fixes}\nsections:\n  - {title: Fixes, categories: [fixes]}\nkinds: [fixes]\n",
+			wantErr: true,
+		},
+		{
+			name:    "section without title",
+			data:    "labels:\n  Fix: {bump: patch}\nsections:\n  - {categories: [fixes]}\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate section title",
+			data:    "labels:\n  Fix: {bump: patch}\nsections:\n  - {title: Fixes, categories: [fixes]}\n  - {title: Fixes, categories: [core]}\n",
+			wantErr: true,
+		},
+		{
+			name:    "category in two sections",
+			data:    "labels:\n  Fix: {bump: patch}\nsections:\n  - {title: Fixes, categories: [fixes]}\n  - {title: Bugs, categories: [fixes]}\n",
+			wantErr: true,
+		},
+		{
+			name:    "two sections without categories",
+			data:    "labels:\n  Fix: {bump: patch}\nsections:\n  - {title: Plugins}\n  - {title: Other}\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse([]byte(tc.data))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Parse() = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Parse() differs (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	if err := Default.Validate(); err != nil {
+		t.Fatalf("Default.Validate() = %v", err)
+	}
+
+	wantBumps := map[string]version.Bump{
+		"Breaking": version.BumpMajor,
+		"Feature":  version.BumpMinor,
+		"Fix":      version.BumpPatch,
+		"core":     version.BumpNone,
+	}
+	if diff := cmp.Diff(wantBumps, Default.Bumps()); diff != "" {
+		t.Errorf("Default.Bumps() differs (-want/+got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(changelog.DefaultPolicy, Default.ChangeLog()); diff != "" {
+		t.Errorf("Default.ChangeLog() differs (-want/+got):\n%s", diff)
+	}
+}
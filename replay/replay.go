@@ -0,0 +1,266 @@
+// Package replay records HTTP interactions to a fixtures directory and serves
+// them back, so that runs against the GitHub API can be repeated offline and
+// deterministically.
+//
+// Each interaction is stored as a JSON file named after its sequence number,
+// e.g. "0001.json". Credentials are redacted before anything is written.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces credentials in recorded interactions.
+const Redacted = "REDACTED"
+
+// redactedHeaders are removed from recorded requests and responses.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// redactedParams are removed from recorded request URLs.
+var redactedParams = []string{"access_token", "client_id", "client_secret"}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is an http.RoundTripper that passes requests on to Transport and
+// writes each interaction to Dir.
+type Recorder struct {
+	// Dir is the fixtures directory. It is created if necessary.
+	Dir string
+	// Transport performs the requests. If nil, http.DefaultTransport is
+	// used.
+	Transport http.RoundTripper
+	// Secrets are replaced by Redacted wherever they occur, e.g. tokens
+	// contained in response bodies.
+	Secrets []string
+
+	mu sync.Mutex
+	n  int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	t := r.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	res, err := t.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	i := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.redact(redactURL(req.URL)),
+			Header: r.redactHeader(req.Header),
+			Body:   r.redact(string(reqBody)),
+		},
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Header:     r.redactHeader(res.Header),
+			Body:       r.redact(string(resBody)),
+		},
+	}
+	if err := r.write(i); err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+
+	return res, nil
+}
+
+func (r *Recorder) write(i Interaction) error {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return err
+	}
+	r.n++
+	return os.WriteFile(filepath.Join(r.Dir, fmt.Sprintf("%04d.json", r.n)), data, 0o644)
+}
+
+func (r *Recorder) redact(s string) string {
+	for _, secret := range r.Secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+	return s
+}
+
+func (r *Recorder) redactHeader(h http.Header) http.Header {
+	ret := make(http.Header)
+	for k, vs := range h {
+		for _, v := range vs {
+			ret.Add(k, r.redact(v))
+		}
+	}
+	for _, k := range redactedHeaders {
+		if ret.Get(k) != "" {
+			ret.Set(k, Redacted)
+		}
+	}
+	return ret
+}
+
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	changed := false
+	for _, p := range redactedParams {
+		if q.Has(p) {
+			q.Set(p, Redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+
+	ret := *u
+	ret.RawQuery = q.Encode()
+	return ret.String()
+}
+
+// Replayer is an http.RoundTripper serving recorded interactions. A request
+// is answered by the first unused interaction with the same method and URL,
+// so that repeated requests for the same URL are answered in the order they
+// were recorded. Request bodies are not compared, because they may contain
+// the current date. Any other request fails.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// Load returns a Replayer serving the interactions recorded in dir.
+func Load(dir string) (*Replayer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("replay: no interactions recorded in %q", dir)
+	}
+	sort.Strings(paths)
+
+	r := &Replayer{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var i Interaction
+		if err := json.Unmarshal(data, &i); err != nil {
+			return nil, fmt.Errorf("replay: %s: %w", path, err)
+		}
+		r.interactions = append(r.interactions, i)
+	}
+	r.used = make([]bool, len(r.interactions))
+
+	return r, nil
+}
+
+// ErrUnexpectedRequest is returned for requests that have not been recorded.
+var ErrUnexpectedRequest = errors.New("unexpected request")
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	u := redactURL(req.URL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for n, i := range r.interactions {
+		if r.used[n] || i.Request.Method != req.Method || i.Request.URL != u {
+			continue
+		}
+		r.used[n] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+			StatusCode:    i.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        i.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(i.Response.Body)),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("replay: %w: %s %s", ErrUnexpectedRequest, req.Method, u)
+}
+
+// Unused returns the interactions that have not been replayed, as
+// "<method> <url>".
+func (r *Replayer) Unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ret []string
+	for n, i := range r.interactions {
+		if !r.used[n] {
+			ret = append(ret, i.Request.Method+" "+i.Request.URL)
+		}
+	}
+	return ret
+}
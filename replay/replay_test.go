@@ -0,0 +1,124 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const token = "ghp_secret"
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Header().Set("Set-Cookie", "session="+token)
+		fmt.Fprintf(w, `{"path":%q,"call":%d,"token":%q}`, req.URL.Path, calls, token)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, c *http.Client, u string) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "token "+token)
+
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := newServer(t)
+	dir := filepath.Join(t.TempDir(), "fixtures")
+
+	rec := &http.Client{
+		Transport: &Recorder{
+			Dir:     dir,
+			Secrets: []string{token},
+		},
+	}
+	urls := []string{
+		srv.URL + "/repos/collectd/collectd/releases",
+		srv.URL + "/repos/collectd/collectd/pulls/1?access_token=" + token,
+		srv.URL + "/repos/collectd/collectd/releases",
+	}
+	var recorded []string
+	for _, u := range urls {
+		recorded = append(recorded, get(t, rec, u))
+	}
+	if !strings.Contains(recorded[0], token) {
+		t.Fatalf("the recorder modified the response passed to the client: %s", recorded[0])
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(urls) {
+		t.Fatalf("got %d fixtures, want %d", len(paths), len(urls))
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), token) {
+			t.Errorf("%s contains the token:\n%s", path, data)
+		}
+	}
+
+	r, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := &http.Client{Transport: r}
+
+	// The two requests for the same URL are answered in the recorded order,
+	// even if other requests are made in between.
+	for _, n := range []int{0, 2, 1} {
+		got := get(t, replay, strings.ReplaceAll(urls[n], token, "another-token"))
+		want := strings.ReplaceAll(recorded[n], token, Redacted)
+		if got != want {
+			t.Errorf("replayed response = %q, want %q", got, want)
+		}
+	}
+
+	if unused := r.Unused(); len(unused) != 0 {
+		t.Errorf("Unused() = %q, want none", unused)
+	}
+
+	// All recorded interactions have been used.
+	_, err = replay.Get(urls[0])
+	if !errors.Is(err, ErrUnexpectedRequest) {
+		t.Errorf("replaying an unexpected request: got error %v, want %v", err, ErrUnexpectedRequest)
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	if _, err := Load(t.TempDir()); err == nil {
+		t.Error("Load(<empty directory>) succeeded, want error")
+	}
+}
@@ -0,0 +1,55 @@
+package version
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bump is the version component a change requires to be incremented.
+type Bump int
+
+const (
+	BumpNone Bump = iota
+	BumpPatch
+	BumpMinor
+	BumpMajor
+)
+
+var bumpNames = []string{
+	BumpNone:  "none",
+	BumpPatch: "patch",
+	BumpMinor: "minor",
+	BumpMajor: "major",
+}
+
+// ParseBump parses the names "none", "patch", "minor" and "major".
+func ParseBump(s string) (Bump, error) {
+	for b, name := range bumpNames {
+		if strings.EqualFold(s, name) {
+			return Bump(b), nil
+		}
+	}
+	return BumpNone, fmt.Errorf("invalid bump %q, want one of %s", s, strings.Join(bumpNames, ", "))
+}
+
+func (b Bump) String() string {
+	if b < 0 || int(b) >= len(bumpNames) {
+		return fmt.Sprintf("Bump(%d)", int(b))
+	}
+	return bumpNames[b]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Bump) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *Bump) UnmarshalText(text []byte) error {
+	parsed, err := ParseBump(string(text))
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
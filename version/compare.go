@@ -0,0 +1,96 @@
+package version
+
+import (
+	"cmp"
+	"regexp"
+	"strings"
+)
+
+// Compare returns -1 if v orders before w, +1 if v orders after w, and 0 if
+// both versions have the same precedence. The tag prefix is ignored.
+//
+// The ordering follows Semantic Versioning: major, minor and patch are
+// compared numerically, and a pre-release orders before the corresponding
+// final version. Pre-release suffixes are compared identifier by identifier.
+// In addition to the Semantic Versioning rules, identifiers with a common
+// alphabetic prefix and a numeric tail, e.g. "rc2" and "rc10", are compared
+// numerically.
+func (v Version) Compare(w Version) int {
+	if c := cmp.Compare(v.major, w.major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.minor, w.minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.patch, w.patch); c != 0 {
+		return c
+	}
+
+	switch {
+	case v.suffix == w.suffix:
+		return 0
+	case v.suffix == "":
+		return 1
+	case w.suffix == "":
+		return -1
+	}
+
+	return comparePreRelease(v.suffix, w.suffix)
+}
+
+// Less returns true if v orders before w.
+func (v Version) Less(w Version) bool {
+	return v.Compare(w) < 0
+}
+
+func comparePreRelease(a, b string) int {
+	aIDs := identifiers(a)
+	bIDs := identifiers(b)
+
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if c := compareIdentifier(aIDs[i], bIDs[i]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(aIDs), len(bIDs))
+}
+
+// identifiers splits a pre-release suffix into its dot-separated identifiers.
+// A leading separator is ignored.
+func identifiers(suffix string) []string {
+	suffix = strings.TrimLeft(suffix, "-.")
+	return strings.Split(suffix, ".")
+}
+
+var identRE = regexp.MustCompile(`^([^0-9]*)([0-9]+)$`)
+
+func compareIdentifier(a, b string) int {
+	aMatch := identRE.FindStringSubmatch(a)
+	bMatch := identRE.FindStringSubmatch(b)
+
+	aNum, bNum := aMatch != nil && aMatch[1] == "", bMatch != nil && bMatch[1] == ""
+	switch {
+	case aNum && bNum:
+		return compareNumeric(aMatch[2], bMatch[2])
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+
+	if aMatch != nil && bMatch != nil && aMatch[1] == bMatch[1] {
+		return compareNumeric(aMatch[2], bMatch[2])
+	}
+
+	return strings.Compare(a, b)
+}
+
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
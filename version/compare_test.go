@@ -0,0 +1,110 @@
+package version_test
+
+import (
+	"testing"
+
+	"github.com/collectd/releaser/version"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		in         string
+		wantMajor  int
+		wantMinor  int
+		wantPatch  int
+		wantSuffix string
+		wantErr    bool
+	}{
+		{in: "6.2.1", wantMajor: 6, wantMinor: 2, wantPatch: 1},
+		{in: "5.12.0-rc3", wantMajor: 5, wantMinor: 12, wantSuffix: "-rc3"},
+		{in: "6.0.0.rc0", wantMajor: 6, wantSuffix: ".rc0"},
+		{in: "collectd-6.0.0", wantErr: true},
+		{in: "6.0", wantErr: true},
+		{in: "6.2.0junk", wantErr: true},
+		{in: "6.2.0-rc1.", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.in, func(t *testing.T) {
+			v, err := version.Parse(tc.in)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("version.Parse(%q) = %v, want error %v", tc.in, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if v.Major() != tc.wantMajor || v.Minor() != tc.wantMinor || v.Patch() != tc.wantPatch || v.Suffix() != tc.wantSuffix {
+				t.Errorf("version.Parse(%q) = (%d, %d, %d, %q), want (%d, %d, %d, %q)", tc.in,
+					v.Major(), v.Minor(), v.Patch(), v.Suffix(),
+					tc.wantMajor, tc.wantMinor, tc.wantPatch, tc.wantSuffix)
+			}
+			if got := v.String(); got != tc.in {
+				t.Errorf("version.Parse(%q).String() = %q", tc.in, got)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Versions in ascending order.
+	ordered := []string{
+		"5.12.0",
+		"6.0.0-alpha",
+		"6.0.0-alpha.1",
+		"6.0.0-alpha.beta",
+		"6.0.0-beta",
+		"6.0.0-beta.2",
+		"6.0.0-beta.11",
+		"6.0.0-rc1",
+		"6.0.0-rc2",
+		"6.0.0-rc10",
+		"6.0.0",
+		"6.0.1",
+		"6.1.0",
+		"6.10.0",
+		"7.0.0",
+	}
+
+	for i, a := range ordered {
+		for j, b := range ordered {
+			va, err := version.Parse(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vb, err := version.Parse(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+
+			if got := va.Compare(vb); got != want {
+				t.Errorf("Parse(%q).Compare(Parse(%q)) = %d, want %d", a, b, got, want)
+			}
+			if got := va.Less(vb); got != (want < 0) {
+				t.Errorf("Parse(%q).Less(Parse(%q)) = %v, want %v", a, b, got, want < 0)
+			}
+		}
+	}
+}
+
+func TestCompareIgnoresPrefix(t *testing.T) {
+	a, err := version.DefaultFormat.Parse("collectd-6.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := version.Parse("6.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := a.Compare(b); got != 0 {
+		t.Errorf("%q.Compare(%q) = %d, want 0", a.Tag(), b.Tag(), got)
+	}
+}
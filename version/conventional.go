@@ -0,0 +1,117 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Classifier selects how pull requests are mapped to version bumps.
+type Classifier int
+
+const (
+	// ClassifyLabels uses the pull request labels and Policy.Labels.
+	ClassifyLabels Classifier = iota
+	// ClassifyConventional uses Conventional Commits pull request titles,
+	// e.g. "feat(cpu): Add metric.".
+	ClassifyConventional
+	// ClassifyHybrid uses the labels of pull requests if they require a
+	// bump and the title otherwise.
+	ClassifyHybrid
+)
+
+var classifierNames = []string{
+	ClassifyLabels:       "labels",
+	ClassifyConventional: "conventional",
+	ClassifyHybrid:       "hybrid",
+}
+
+// ParseClassifier parses the names "labels", "conventional" and "hybrid".
+func ParseClassifier(s string) (Classifier, error) {
+	for c, name := range classifierNames {
+		if strings.EqualFold(s, name) {
+			return Classifier(c), nil
+		}
+	}
+	return ClassifyLabels, fmt.Errorf("invalid classifier %q, want one of %s", s, strings.Join(classifierNames, ", "))
+}
+
+func (c Classifier) String() string {
+	if c < 0 || int(c) >= len(classifierNames) {
+		return fmt.Sprintf("Classifier(%d)", int(c))
+	}
+	return classifierNames[c]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Classifier) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Classifier) UnmarshalText(text []byte) error {
+	parsed, err := ParseClassifier(string(text))
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+// Conventional is a pull request title following the Conventional Commits
+// specification, e.g. "feat(write_prometheus)!: Remove option.".
+type Conventional struct {
+	Type        string
+	Scope       string
+	Breaking    bool
+	Description string
+}
+
+var (
+	conventionalRE = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: *(.*)$`)
+	breakingRE     = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+)
+
+// ParseConventional parses the title and body of a pull request. The body is
+// searched for a "BREAKING CHANGE:" footer. It returns false if title does not
+// follow the Conventional Commits format.
+func ParseConventional(title, body string) (Conventional, bool) {
+	m := conventionalRE.FindStringSubmatch(strings.TrimSpace(title))
+	if m == nil {
+		return Conventional{}, false
+	}
+
+	return Conventional{
+		Type:        strings.ToLower(m[1]),
+		Scope:       strings.TrimSpace(m[2]),
+		Breaking:    m[3] == "!" || breakingRE.MatchString(body),
+		Description: m[4],
+	}, true
+}
+
+// Bump returns the bump required by c: major for breaking changes, minor for
+// "feat", patch for "fix" and none otherwise.
+func (c Conventional) Bump() Bump {
+	switch {
+	case c.Breaking:
+		return BumpMajor
+	case c.Type == "feat":
+		return BumpMinor
+	case c.Type == "fix":
+		return BumpPatch
+	default:
+		return BumpNone
+	}
+}
+
+// classifyTitle returns the bump required by the Conventional Commits title
+// of pr and a human readable reason.
+func classifyTitle(pr *github.PullRequest) (Bump, string) {
+	c, ok := ParseConventional(pr.GetTitle(), pr.GetBody())
+	if !ok {
+		return BumpNone, ""
+	}
+	return c.Bump(), fmt.Sprintf("title %q", pr.GetTitle())
+}
@@ -0,0 +1,146 @@
+package version_test
+
+import (
+	"testing"
+
+	"github.com/collectd/releaser/version"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/github"
+)
+
+func TestParseConventional(t *testing.T) {
+	cases := []struct {
+		title  string
+		body   string
+		want   version.Conventional
+		wantOK bool
+	}{
+		{
+			title:  "feat: Add option.",
+			want:   version.Conventional{Type: "feat", Description: "Add option."},
+			wantOK: true,
+		},
+		{
+			title:  "fix(write_prometheus): Fix escaping.",
+			want:   version.Conventional{Type: "fix", Scope: "write_prometheus", Description: "Fix escaping."},
+			wantOK: true,
+		},
+		{
+			title:  "feat(cpu)!: Remove the ValuesPercentage option.",
+			want:   version.Conventional{Type: "feat", Scope: "cpu", Breaking: true, Description: "Remove the ValuesPercentage option."},
+			wantOK: true,
+		},
+		{
+			title:  "refactor: Simplify parser.",
+			body:   "Some text.\n\nBREAKING CHANGE: the parser no longer accepts tabs.",
+			want:   version.Conventional{Type: "refactor", Breaking: true, Description: "Simplify parser."},
+			wantOK: true,
+		},
+		{
+			title: "Write Prometheus plugin: Fix escaping.",
+		},
+		{
+			title: "Merge branch 'main'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			got, ok := version.ParseConventional(tc.title, tc.body)
+			if ok != tc.wantOK {
+				t.Fatalf("version.ParseConventional(%q) = %v, want %v", tc.title, ok, tc.wantOK)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("version.ParseConventional(%q) differs (-want/+got):\n%s", tc.title, diff)
+			}
+		})
+	}
+}
+
+func TestNextClassifier(t *testing.T) {
+	makePR := func(title string, labels ...string) *github.PullRequest {
+		pr := makePRWithLabels(labels...)
+		pr.Title = github.String(title)
+		return pr
+	}
+
+	prev, err := version.Parse("6.1.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		classifier version.Classifier
+		prs        []*github.PullRequest
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "labels ignore titles",
+			classifier: version.ClassifyLabels,
+			prs: []*github.PullRequest{
+				makePR("feat: Add option.", "Fix"),
+			},
+			want: "6.1.4",
+		},
+		{
+			name:       "conventional ignores labels",
+			classifier: version.ClassifyConventional,
+			prs: []*github.PullRequest{
+				makePR("feat: Add option.", "Fix"),
+				makePR("Unconventional title", "Breaking"),
+			},
+			want: "6.2.0",
+		},
+		{
+			name:       "conventional breaking change",
+			classifier: version.ClassifyConventional,
+			prs: []*github.PullRequest{
+				makePR("fix!: Change default."),
+			},
+			wantErr: true,
+		},
+		{
+			name:       "hybrid uses titles of unlabeled PRs",
+			classifier: version.ClassifyHybrid,
+			prs: []*github.PullRequest{
+				makePR("feat: Add option."),
+				makePR("Fix something", "Fix"),
+			},
+			want: "6.2.0",
+		},
+		{
+			name:       "hybrid labels override titles",
+			classifier: version.ClassifyHybrid,
+			prs: []*github.PullRequest{
+				makePR("feat: Add option.", "Fix"),
+			},
+			want: "6.1.4",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			next, err := prev.Next(tc.prs, version.Policy{Classifier: tc.classifier})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Version.Next() = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := next.String(); got != tc.want {
+				t.Errorf("Version.Next() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseClassifier(t *testing.T) {
+	for _, want := range []version.Classifier{version.ClassifyLabels, version.ClassifyConventional, version.ClassifyHybrid} {
+		got, err := version.ParseClassifier(want.String())
+		if err != nil || got != want {
+			t.Errorf("version.ParseClassifier(%q) = (%v, %v), want (%v, nil)", want.String(), got, err, want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"sync"
 
 	"github.com/google/go-github/github"
 )
@@ -12,68 +13,247 @@ import (
 type Version struct {
 	major, minor, patch int
 	suffix              string
+	prefix              string
 }
 
-var tagRE = regexp.MustCompile(`^collectd-(6)\.([0-9]+)\.([0-9]+)(.*)$`)
+// Format describes how versions are encoded in tag names.
+type Format struct {
+	// TagPrefix is prepended to the version number to form the tag name,
+	// e.g. "collectd-".
+	TagPrefix string
+	// Majors restricts the accepted major versions. If empty, all major
+	// versions are accepted.
+	Majors []int
+}
+
+// DefaultFormat is the tag format used by collectd 6.
+var DefaultFormat = Format{
+	TagPrefix: "collectd-",
+	Majors:    []int{6},
+}
+
+// suffixPattern matches an optional pre-release suffix: '-' or '.' followed by
+// dot-separated identifiers, e.g. "-rc1" or "-beta.2".
+const suffixPattern = `((?:[-.][0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?)`
+
+// tagREs caches the regular expressions returned by Format.tagRE by tag
+// prefix.
+var tagREs sync.Map
 
+// tagRE returns the regular expression matching tag names of f. It is
+// compiled on first use.
+func (f Format) tagRE() *regexp.Regexp {
+	if re, ok := tagREs.Load(f.TagPrefix); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(f.TagPrefix) + `([0-9]+)\.([0-9]+)\.([0-9]+)` + suffixPattern + `$`)
+	actual, _ := tagREs.LoadOrStore(f.TagPrefix, re)
+	return actual.(*regexp.Regexp)
+}
+
+// New parses the tag name of rel using DefaultFormat.
 func New(rel *github.RepositoryRelease) (Version, error) {
-	m := tagRE.FindStringSubmatch(rel.GetTagName())
-	if len(m) != 4 && len(m) != 5 {
-		return Version{}, fmt.Errorf("unable to parse tag %q", rel.GetTagName())
+	return DefaultFormat.New(rel)
+}
+
+// Parse parses a plain version string without tag prefix, e.g. "6.2.0-rc0".
+func Parse(s string) (Version, error) {
+	return Format{}.Parse(s)
+}
+
+// New parses the tag name of rel.
+func (f Format) New(rel *github.RepositoryRelease) (Version, error) {
+	return f.Parse(rel.GetTagName())
+}
+
+// Parse parses the tag name tag.
+func (f Format) Parse(tag string) (Version, error) {
+	m := f.tagRE().FindStringSubmatch(tag)
+	if len(m) != 5 {
+		return Version{}, fmt.Errorf("unable to parse tag %q", tag)
 	}
 
 	major, _ := strconv.Atoi(m[1])
 	minor, _ := strconv.Atoi(m[2])
 	patch, _ := strconv.Atoi(m[3])
-	var suffix string
-	if len(m) > 4 {
-		suffix = m[4]
+
+	if !f.allowsMajor(major) {
+		return Version{}, fmt.Errorf("tag %q: major version %d is not one of %v", tag, major, f.Majors)
 	}
 
 	return Version{
 		major:  major,
 		minor:  minor,
 		patch:  patch,
-		suffix: suffix,
+		suffix: m[4],
+		prefix: f.TagPrefix,
 	}, nil
 }
 
+func (f Format) allowsMajor(major int) bool {
+	if len(f.Majors) == 0 {
+		return true
+	}
+	for _, m := range f.Majors {
+		if m == major {
+			return true
+		}
+	}
+	return false
+}
+
+// Major returns the major version, e.g. 6 for 6.2.1.
+func (v Version) Major() int {
+	return v.major
+}
+
+// Minor returns the minor version, e.g. 2 for 6.2.1.
+func (v Version) Minor() int {
+	return v.minor
+}
+
+// Patch returns the patch version, e.g. 1 for 6.2.1.
+func (v Version) Patch() int {
+	return v.patch
+}
+
+// Suffix returns the pre-release suffix including its separator, e.g. "-rc0"
+// for 6.2.0-rc0. Final versions have an empty suffix.
+func (v Version) Suffix() string {
+	return v.suffix
+}
+
 func (v Version) String() string {
 	return fmt.Sprintf("%d.%d.%d%s", v.major, v.minor, v.patch, v.suffix)
 }
 
 func (v Version) Tag() string {
-	return "collectd-" + v.String()
+	return v.prefix + v.String()
 }
 
-func (v Version) Next(prs []*github.PullRequest) (Version, error) {
-	var maxPRType prType
-	for _, pr := range prs {
-		if t := classifyPR(pr); maxPRType < t {
-			maxPRType = t
-		}
+// Policy controls how Next derives the next version from pull requests.
+type Policy struct {
+	// Classifier selects whether labels, titles or both are used to
+	// classify pull requests.
+	Classifier Classifier
+	// Labels maps label names to the bump they require. If nil,
+	// DefaultLabels is used.
+	Labels map[string]Bump
+	// AllowMajor confirms that the major version may be incremented. If
+	// unset, Next returns an error instead of bumping the major version.
+	AllowMajor bool
+	// PreRelease is the suffix used for release candidates, e.g. "-rc". If
+	// set, Next returns the first release candidate ("-rc0") of the next
+	// version instead of the final version. If empty, Next returns final
+	// versions.
+	PreRelease string
+}
+
+// DefaultLabels is the label table used if Policy.Labels is nil.
+var DefaultLabels = map[string]Bump{
+	"Breaking": BumpMajor,
+	"Feature":  BumpMinor,
+	"Fix":      BumpPatch,
+}
+
+func (p Policy) labels() map[string]Bump {
+	if p.Labels == nil {
+		return DefaultLabels
 	}
+	return p.Labels
+}
 
-	ret := v
-	switch maxPRType {
-	case typeFeature:
-		ret.minor++
-	case typeFix:
-		ret.patch++
-	default:
+// IsPreRelease returns true if v has a suffix, e.g. "-rc0".
+func (v Version) IsPreRelease() bool {
+	return v.suffix != ""
+}
+
+// Next returns the version following v, given the pull requests merged since
+// v. Lower components are reset when a higher component is incremented.
+//
+// If v is a pre-release, the pre-release number is incremented as long as v
+// already accounts for the changes in prs, e.g. 6.2.0-rc0 becomes 6.2.0-rc1
+// if prs contain only features and fixes. Otherwise the first pre-release of
+// the next version is returned, e.g. 6.1.4-rc0 becomes 6.2.0-rc0 if prs
+// contain a feature. Use Promote to turn a pre-release into a final version.
+func (v Version) Next(prs []*github.PullRequest, p Policy) (Version, error) {
+	d := p.Decide(prs)
+
+	if d.Bump == BumpNone {
 		return Version{}, errors.New("no features or fixes in list of PRs")
 	}
+	if d.Bump == BumpMajor && !p.AllowMajor {
+		return Version{}, fmt.Errorf("PR #%d requires a major release because of its %s, which has not been allowed", d.PR, d.Reason)
+	}
+
+	if v.IsPreRelease() && d.Bump <= v.level() {
+		return v.nextSuffix(), nil
+	}
+
+	ret := v.bump(d.Bump)
+	switch {
+	case v.IsPreRelease():
+		ret.suffix = firstSuffix(v.suffix)
+	case p.PreRelease != "":
+		ret.suffix = firstSuffix(p.PreRelease)
+	}
+
+	return ret, nil
+}
 
-	if v.suffix != "" {
-		return v.nextSuffix()
+// Promote returns the final version of the pre-release v, e.g. 6.2.0 for
+// 6.2.0-rc2.
+func (v Version) Promote() (Version, error) {
+	if !v.IsPreRelease() {
+		return Version{}, fmt.Errorf("version %s is not a pre-release", v)
 	}
 
+	ret := v
+	ret.suffix = ""
 	return ret, nil
 }
 
+// bump increments the component of v corresponding to t and resets all lower
+// components. The suffix is removed.
+func (v Version) bump(t Bump) Version {
+	ret := Version{
+		major:  v.major,
+		minor:  v.minor,
+		patch:  v.patch,
+		prefix: v.prefix,
+	}
+
+	switch t {
+	case BumpMajor:
+		ret.major++
+		ret.minor = 0
+		ret.patch = 0
+	case BumpMinor:
+		ret.minor++
+		ret.patch = 0
+	case BumpPatch:
+		ret.patch++
+	}
+
+	return ret
+}
+
+// level returns the most significant kind of change v can contain relative to
+// its predecessor, e.g. BumpMinor for 6.2.0 and BumpPatch for 6.2.1.
+func (v Version) level() Bump {
+	switch {
+	case v.patch != 0:
+		return BumpPatch
+	case v.minor != 0:
+		return BumpMinor
+	default:
+		return BumpMajor
+	}
+}
+
 var suffixRE = regexp.MustCompile(`^([^0-9]*)([0-9]+)(.*)$`)
 
-func (v Version) nextSuffix() (Version, error) {
+func (v Version) nextSuffix() Version {
 	ret := v
 
 	m := suffixRE.FindStringSubmatch(v.suffix)
@@ -84,31 +264,79 @@ func (v Version) nextSuffix() (Version, error) {
 		ret.suffix += "0"
 	}
 
-	return ret, nil
+	return ret
+}
+
+// firstSuffix returns the suffix of the first pre-release in the series of
+// suffix, e.g. "-rc0" for "-rc" and ".rc0" for ".rc3".
+func firstSuffix(suffix string) string {
+	if m := suffixRE.FindStringSubmatch(suffix); len(m) == 4 {
+		return m[1] + "0" + m[3]
+	}
+	return suffix + "0"
 }
 
-type prType int
+// Decision explains the bump chosen by Next.
+type Decision struct {
+	// Bump is the highest bump required by any of the pull requests.
+	Bump Bump
+	// PR is the number of the first pull request requiring Bump.
+	PR int
+	// Reason is a human readable reason why PR requires Bump, e.g.
+	// `label "Feature"`.
+	Reason string
+}
 
-const (
-	typeMaintenance prType = iota
-	typeFix
-	typeFeature
-)
+func (d Decision) String() string {
+	if d.Bump == BumpNone {
+		return "no pull request requires a release"
+	}
+	return fmt.Sprintf("%s bump required by PR #%d (%s)", d.Bump, d.PR, d.Reason)
+}
+
+// Decide returns the highest bump required by prs.
+func (p Policy) Decide(prs []*github.PullRequest) Decision {
+	var ret Decision
+	for _, pr := range prs {
+		if b, reason := p.Classify(pr); ret.Bump < b {
+			ret = Decision{
+				Bump:   b,
+				PR:     pr.GetNumber(),
+				Reason: reason,
+			}
+		}
+	}
+	return ret
+}
 
-func classifyPR(pr *github.PullRequest) prType {
-	var isFix bool
-	for _, label := range pr.Labels {
-		switch label.GetName() {
-		case "Feature":
-			return typeFeature
-		case "Fix":
-			isFix = true
-		default:
-			// no op
+// Classify returns the bump required by pr and a human readable reason,
+// using the classifier selected by p.
+func (p Policy) Classify(pr *github.PullRequest) (Bump, string) {
+	switch p.Classifier {
+	case ClassifyConventional:
+		return classifyTitle(pr)
+	case ClassifyHybrid:
+		if b, reason := classifyLabels(pr, p); b != BumpNone {
+			return b, reason
 		}
+		return classifyTitle(pr)
+	default:
+		return classifyLabels(pr, p)
 	}
-	if isFix {
-		return typeFix
+}
+
+// classifyLabels returns the highest bump required by the labels of pr and
+// the label requiring it.
+func classifyLabels(pr *github.PullRequest, p Policy) (Bump, string) {
+	var (
+		ret    Bump
+		reason string
+	)
+	for _, l := range pr.Labels {
+		if b := p.labels()[l.GetName()]; ret < b {
+			ret = b
+			reason = fmt.Sprintf("label %q", l.GetName())
+		}
 	}
-	return typeMaintenance
+	return ret, reason
 }
@@ -70,6 +70,114 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestFormatRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		format  version.Format
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "default format",
+			format: version.DefaultFormat,
+			tag:    "collectd-6.1.2",
+			want:   "6.1.2",
+		},
+		{
+			name: "maintenance branch",
+			format: version.Format{
+				TagPrefix: "collectd-",
+				Majors:    []int{5},
+			},
+			tag:  "collectd-5.12.1",
+			want: "5.12.1",
+		},
+		{
+			name: "major version not allowed",
+			format: version.Format{
+				TagPrefix: "collectd-",
+				Majors:    []int{5},
+			},
+			tag:     "collectd-6.0.0",
+			wantErr: true,
+		},
+		{
+			name: "any major version",
+			format: version.Format{
+				TagPrefix: "v",
+			},
+			tag:  "v2.3.4-rc1",
+			want: "2.3.4-rc1",
+		},
+		{
+			name:   "empty prefix",
+			format: version.Format{},
+			tag:    "1.0.0",
+			want:   "1.0.0",
+		},
+		{
+			name: "prefix is not a pattern",
+			format: version.Format{
+				TagPrefix: "v.",
+			},
+			tag:     "vx1.0.0",
+			wantErr: true,
+		},
+		{
+			name:   "dotted suffix",
+			format: version.DefaultFormat,
+			tag:    "collectd-6.2.0-beta.1",
+			want:   "6.2.0-beta.1",
+		},
+		{
+			name:    "suffix without separator",
+			format:  version.DefaultFormat,
+			tag:     "collectd-6.2.0foo",
+			wantErr: true,
+		},
+		{
+			name:    "empty suffix",
+			format:  version.DefaultFormat,
+			tag:     "collectd-6.2.0-",
+			wantErr: true,
+		},
+		{
+			name:    "empty identifier",
+			format:  version.DefaultFormat,
+			tag:     "collectd-6.2.0-rc..1",
+			wantErr: true,
+		},
+		{
+			name:    "suffix with space",
+			format:  version.DefaultFormat,
+			tag:     "collectd-6.2.0 rc1",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rel := &github.RepositoryRelease{
+				TagName: github.String(tc.tag),
+			}
+			v, err := tc.format.New(rel)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Format.New(%q) = %v, want error %v", tc.tag, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := v.String(); got != tc.want {
+				t.Errorf("Format.New(%q).String() = %q, want %q", tc.tag, got, tc.want)
+			}
+			if got := v.Tag(); got != tc.tag {
+				t.Errorf("Format.New(%q).Tag() = %q, want %q", tc.tag, got, tc.tag)
+			}
+		})
+	}
+}
+
 func TestNext(t *testing.T) {
 	makeVersion := func(tag string) version.Version {
 		v, err := version.New(&github.RepositoryRelease{
@@ -85,6 +193,7 @@ func TestNext(t *testing.T) {
 		name    string
 		prev    version.Version
 		prs     []*github.PullRequest
+		policy  version.Policy
 		want    string
 		wantErr bool
 	}{
@@ -108,6 +217,56 @@ func TestNext(t *testing.T) {
 			},
 			want: "6.0.1",
 		},
+		{
+			name: "breaking release",
+			prev: makeVersion("collectd-6.2.3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Fix"),
+				makePRWithLabels("Feature", "Breaking"),
+			},
+			policy: version.Policy{
+				AllowMajor: true,
+			},
+			want: "7.0.0",
+		},
+		{
+			name: "breaking release not allowed",
+			prev: makeVersion("collectd-6.2.3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Fix"),
+				makePRWithLabels("Breaking"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "custom breaking label",
+			prev: makeVersion("collectd-6.2.3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Breaking"),
+				makePRWithLabels("Incompatible"),
+			},
+			policy: version.Policy{
+				Labels:     map[string]version.Bump{"Incompatible": version.BumpMajor},
+				AllowMajor: true,
+			},
+			want: "7.0.0",
+		},
+		{
+			name: "custom label table",
+			prev: makeVersion("collectd-6.2.3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Feature"),
+				makePRWithLabels("bug", "docs"),
+			},
+			policy: version.Policy{
+				Labels: map[string]version.Bump{
+					"enhancement": version.BumpMinor,
+					"bug":         version.BumpPatch,
+					"docs":        version.BumpNone,
+				},
+			},
+			want: "6.2.4",
+		},
 		{
 			name: "maintenance only",
 			prev: makeVersion("collectd-6.0.0"),
@@ -137,11 +296,106 @@ func TestNext(t *testing.T) {
 			},
 			want: "6.0.0.rc1",
 		},
+		{
+			name: "feature release resets patch",
+			prev: makeVersion("collectd-6.1.3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Fix"),
+				makePRWithLabels("Feature"),
+			},
+			want: "6.2.0",
+		},
+		{
+			name: "first release candidate",
+			prev: makeVersion("collectd-6.1.3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Feature"),
+			},
+			policy: version.Policy{
+				PreRelease: "-rc",
+			},
+			want: "6.2.0-rc0",
+		},
+		{
+			name: "first fix release candidate",
+			prev: makeVersion("collectd-6.1.3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Fix"),
+			},
+			policy: version.Policy{
+				PreRelease: "-rc",
+			},
+			want: "6.1.4-rc0",
+		},
+		{
+			name: "fix in feature release candidate",
+			prev: makeVersion("collectd-6.2.0-rc0"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Fix"),
+			},
+			policy: version.Policy{
+				PreRelease: "-rc",
+			},
+			want: "6.2.0-rc1",
+		},
+		{
+			name: "feature in feature release candidate",
+			prev: makeVersion("collectd-6.2.0-rc1"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Feature"),
+			},
+			policy: version.Policy{
+				PreRelease: "-rc",
+			},
+			want: "6.2.0-rc2",
+		},
+		{
+			name: "feature in fix release candidate",
+			prev: makeVersion("collectd-6.1.4-rc0"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Feature"),
+			},
+			policy: version.Policy{
+				PreRelease: "-rc",
+			},
+			want: "6.2.0-rc0",
+		},
+		{
+			name: "breaking change in feature release candidate",
+			prev: makeVersion("collectd-6.2.0-rc2"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Breaking"),
+			},
+			policy: version.Policy{
+				AllowMajor: true,
+				PreRelease: "-rc",
+			},
+			want: "7.0.0-rc0",
+		},
+		{
+			name: "release candidate keeps its suffix style",
+			prev: makeVersion("collectd-6.1.4.rc3"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Feature"),
+			},
+			policy: version.Policy{
+				PreRelease: "-rc",
+			},
+			want: "6.2.0.rc0",
+		},
+		{
+			name: "maintenance only in release candidate",
+			prev: makeVersion("collectd-6.2.0-rc0"),
+			prs: []*github.PullRequest{
+				makePRWithLabels("Maintenance"),
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			next, err := tc.prev.Next(tc.prs)
+			next, err := tc.prev.Next(tc.prs, tc.policy)
 			if gotErr := err != nil; gotErr != tc.wantErr {
 				t.Fatalf("Version.Next() = %v, want error %v", err, tc.wantErr)
 			}
@@ -154,3 +408,53 @@ func TestNext(t *testing.T) {
 		})
 	}
 }
+
+func TestPromote(t *testing.T) {
+	cases := []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{tag: "collectd-6.2.0-rc2", want: "6.2.0"},
+		{tag: "collectd-6.0.0.rc0", want: "6.0.0"},
+		{tag: "collectd-6.2.0", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tag, func(t *testing.T) {
+			v, err := version.New(&github.RepositoryRelease{
+				TagName: github.String(tc.tag),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := v.Promote()
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Version.Promote() = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got.String() != tc.want {
+				t.Errorf("Version.Promote() = %q, want %q", got, tc.want)
+			}
+			if got.IsPreRelease() {
+				t.Errorf("Version.Promote().IsPreRelease() = true, want false")
+			}
+		})
+	}
+}
+
+func TestParseBump(t *testing.T) {
+	for _, want := range []version.Bump{version.BumpNone, version.BumpPatch, version.BumpMinor, version.BumpMajor} {
+		got, err := version.ParseBump(want.String())
+		if err != nil || got != want {
+			t.Errorf("version.ParseBump(%q) = (%v, %v), want (%v, nil)", want.String(), got, err, want)
+		}
+	}
+
+	if _, err := version.ParseBump("huge"); err == nil {
+		t.Errorf("version.ParseBump(%q) succeeded, want error", "huge")
+	}
+}
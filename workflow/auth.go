@@ -0,0 +1,165 @@
+package workflow
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// appTokenSource creates GitHub App installation access tokens. Installation
+// tokens expire after an hour; wrapped in oauth2.ReuseTokenSource, a new
+// token is created shortly before the previous one expires.
+type appTokenSource struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	// baseURL is the REST API base URL, with a trailing slash.
+	baseURL string
+	client  *http.Client
+	now     func() time.Time
+}
+
+func newAppTokenSource(opts Options, baseURL string) (oauth2.TokenSource, error) {
+	key, err := loadPrivateKey(opts.AppPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return oauth2.ReuseTokenSource(nil, &appTokenSource{
+		appID:          opts.AppID,
+		installationID: opts.AppInstallationID,
+		key:            key,
+		baseURL:        baseURL,
+		client:         http.DefaultClient,
+		now:            time.Now,
+	}), nil
+}
+
+// loadPrivateKey reads a PEM encoded RSA private key, as downloaded from the
+// GitHub App settings.
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: got a %T, want an RSA private key", path, key)
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %q", path, block.Type)
+	}
+}
+
+// jwt returns a JSON Web Token authenticating the app, valid for ten minutes.
+func (s *appTokenSource) jwt() (string, error) {
+	now := s.now()
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	}
+	claims := map[string]any{
+		// Allow for clock skew.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+		"iss": s.appID,
+	}
+
+	var parts []string
+	for _, v := range []any{header, claims} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, base64.RawURLEncoding.EncodeToString(data))
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(parts, ".")))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(append(parts, base64.RawURLEncoding.EncodeToString(sig)), "."), nil
+}
+
+// Token creates a new installation access token.
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.JoinPath(s.baseURL, "app", "installations", fmt.Sprint(s.installationID), "access_tokens")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("Apps.CreateInstallationToken(%d): %s: %s", s.installationID, res.Status, body)
+	}
+
+	var t struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return nil, fmt.Errorf("Apps.CreateInstallationToken(%d): %w", s.installationID, err)
+	}
+	if t.Token == "" {
+		return nil, errors.New("Apps.CreateInstallationToken: the response contains no token")
+	}
+
+	return &oauth2.Token{
+		AccessToken: t.Token,
+		TokenType:   "token",
+		Expiry:      t.ExpiresAt,
+	}, nil
+}
@@ -0,0 +1,162 @@
+package workflow
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeKey writes a new RSA private key in the format used by GitHub.
+func writeKey(t *testing.T) (*rsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.pem")
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return key, path
+}
+
+// verifyJWT returns the claims of token if it has been signed with key.
+func verifyJWT(token string, key *rsa.PublicKey) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("got %d parts, want 3", len(parts))
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	err = json.Unmarshal(data, &claims)
+	return claims, err
+}
+
+// TestGitHubEnterpriseApp uses GitHub App authentication against a GitHub
+// Enterprise server.
+func TestGitHubEnterpriseApp(t *testing.T) {
+	key, keyFile := writeKey(t)
+
+	var (
+		mu       sync.Mutex
+		tokens   int
+		expiries = []time.Duration{time.Second, time.Hour}
+		paths    []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if req.URL.Path == "/api/v3/app/installations/42/access_tokens" {
+			claims, err := verifyJWT(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+			if err != nil || claims["iss"] != float64(7) {
+				http.Error(w, fmt.Sprintf("invalid JWT: %v, %v", claims, err), http.StatusUnauthorized)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token":"ghs_%d","expires_at":%q}`, tokens, time.Now().Add(expiries[tokens]).Format(time.RFC3339))
+			tokens++
+			return
+		}
+
+		paths = append(paths, req.Method+" "+req.URL.Path+" "+req.Header.Get("Authorization"))
+		if req.URL.Path == "/api/graphql" {
+			fmt.Fprint(w, `{"data":{}}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+
+	c, err := newClient(Options{
+		AppID:             7,
+		AppInstallationID: 42,
+		AppPrivateKeyFile: keyFile,
+		BaseURL:           srv.URL + "/api/v3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.Repositories.ListReleases(ctx, "collectd", "collectd", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var res struct{}
+	if err := c.GraphQL.Query(ctx, "query { viewer { login } }", nil, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first token expires within the expiry margin and is replaced
+	// immediately; the second one is reused.
+	want := []string{
+		"GET /api/v3/repos/collectd/collectd/releases token ghs_0",
+		"GET /api/v3/repos/collectd/collectd/releases token ghs_1",
+		"GET /api/v3/repos/collectd/collectd/releases token ghs_1",
+		"POST /api/graphql token ghs_1",
+	}
+	if diff := cmp.Diff(want, paths); diff != "" {
+		t.Errorf("requests differ (-want/+got):\n%s", diff)
+	}
+}
+
+func TestAPIURLs(t *testing.T) {
+	cases := []struct {
+		base, upload         string
+		wantBase, wantUpload string
+	}{
+		{"", "", "https://api.github.com/", "https://uploads.github.com/"},
+		{"https://github.example.com/api/v3", "", "https://github.example.com/api/v3/", "https://github.example.com/api/uploads/"},
+		{"https://github.example.com/api/v3/", "https://uploads.example.com/", "https://github.example.com/api/v3/", "https://uploads.example.com/"},
+	}
+
+	for _, tc := range cases {
+		base, upload, err := apiURLs(Options{BaseURL: tc.base, UploadURL: tc.upload})
+		if err != nil {
+			t.Errorf("apiURLs(%q, %q) = %v", tc.base, tc.upload, err)
+			continue
+		}
+		if base != tc.wantBase || upload != tc.wantUpload {
+			t.Errorf("apiURLs(%q, %q) = (%q, %q), want (%q, %q)", tc.base, tc.upload, base, upload, tc.wantBase, tc.wantUpload)
+		}
+	}
+}
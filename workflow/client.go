@@ -0,0 +1,308 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/collectd/releaser/replay"
+	"github.com/google/go-github/github"
+	"github.com/octo/retry"
+	"golang.org/x/oauth2"
+)
+
+// Client is the subset of the GitHub API used by the Releaser. The services
+// mirror those of *github.Client, so that method names and signatures match
+// the go-github documentation. The fakegithub package provides an in-memory
+// implementation.
+type Client struct {
+	Repositories RepositoriesService
+	Git          GitService
+	PullRequests PullRequestsService
+	Issues       IssuesService
+	Checks       ChecksService
+	GraphQL      GraphQLService
+
+	// rateLimit is nil unless the client was created by New.
+	rateLimit *rateLimitTransport
+	// replayer is nil unless the client was created by New with
+	// Options.ReplayDir.
+	replayer *replay.Replayer
+}
+
+// RepositoriesService is the subset of *github.RepositoriesService used by
+// the Releaser.
+type RepositoriesService interface {
+	GetBranch(ctx context.Context, owner, repo, branch string) (*github.Branch, *github.Response, error)
+	GetContents(ctx context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error)
+	GetCombinedStatus(ctx context.Context, owner, repo, ref string, opt *github.ListOptions) (*github.CombinedStatus, *github.Response, error)
+	// CompareCommits returns one page of the commits between base and head,
+	// oldest first.
+	CompareCommits(ctx context.Context, owner, repo, base, head string, opt *github.ListOptions) (*github.CommitsComparison, *github.Response, error)
+	ListReleases(ctx context.Context, owner, repo string, opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error)
+	GetReleaseByTag(ctx context.Context, owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error)
+	CreateRelease(ctx context.Context, owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error)
+}
+
+// GitService is the subset of *github.GitService used by the Releaser.
+type GitService interface {
+	GetCommit(ctx context.Context, owner, repo, sha string) (*github.Commit, *github.Response, error)
+	CreateTree(ctx context.Context, owner, repo, baseTree string, entries []github.TreeEntry) (*github.Tree, *github.Response, error)
+	CreateCommit(ctx context.Context, owner, repo string, commit *github.Commit) (*github.Commit, *github.Response, error)
+	GetRef(ctx context.Context, owner, repo, ref string) (*github.Reference, *github.Response, error)
+	UpdateRef(ctx context.Context, owner, repo string, ref *github.Reference, force bool) (*github.Reference, *github.Response, error)
+	GetTag(ctx context.Context, owner, repo, sha string) (*github.Tag, *github.Response, error)
+}
+
+// PullRequestsService is the subset of *github.PullRequestsService used by
+// the Releaser.
+type PullRequestsService interface {
+	Get(ctx context.Context, owner, repo string, number int) (*github.PullRequest, *github.Response, error)
+	List(ctx context.Context, owner, repo string, opt *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error)
+	// ListPullRequestsWithCommit returns the pull requests associated with
+	// the commit sha.
+	ListPullRequestsWithCommit(ctx context.Context, owner, repo, sha string, opt *github.ListOptions) ([]*github.PullRequest, *github.Response, error)
+}
+
+// IssuesService is the subset of *github.IssuesService used by the Releaser.
+type IssuesService interface {
+	ListLabels(ctx context.Context, owner, repo string, opt *github.ListOptions) ([]*github.Label, *github.Response, error)
+	ListComments(ctx context.Context, owner, repo string, number int, opt *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error)
+	CreateComment(ctx context.Context, owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+}
+
+// ChecksService is the subset of *github.ChecksService used by the Releaser.
+type ChecksService interface {
+	ListCheckRunsForRef(ctx context.Context, owner, repo, ref string, opt *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error)
+}
+
+// GraphQLService runs queries against the GitHub GraphQL API.
+type GraphQLService interface {
+	// Query runs query with variables and decodes the "data" member of the
+	// response into result. Errors reported in the response are returned
+	// as error.
+	Query(ctx context.Context, query string, variables map[string]any, result any) error
+}
+
+func newClient(opts Options) (*Client, error) {
+	baseURL, uploadURL, err := apiURLs(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		base     http.RoundTripper
+		replayer *replay.Replayer
+	)
+	switch {
+	case opts.ReplayDir != "":
+		replayer, err = replay.Load(opts.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+		base = replayer
+	case opts.AppID != 0:
+		src, err := newAppTokenSource(opts, baseURL)
+		if err != nil {
+			return nil, err
+		}
+		base = &oauth2.Transport{
+			Source: src,
+		}
+	default:
+		base = &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: opts.AccessToken}),
+		}
+	}
+
+	if opts.RecordDir != "" && opts.ReplayDir == "" {
+		base = &replay.Recorder{
+			Dir:       opts.RecordDir,
+			Transport: base,
+			Secrets:   []string{opts.AccessToken},
+		}
+	}
+
+	// The rate limit transport waits for rate limits itself and returns an
+	// error when giving up, which retry.Transport does not retry.
+	rl := newRateLimitTransport(base)
+	if opts.ReplayDir != "" {
+		rl.sleep = func(context.Context, time.Duration) error { return nil }
+	}
+
+	gh, err := github.NewEnterpriseClient(baseURL, uploadURL, &http.Client{
+		Transport: &retry.Transport{
+			RoundTripper: rl,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewClient(gh)
+	c.rateLimit = rl
+	c.replayer = replayer
+	return c, nil
+}
+
+// UnusedInteractions returns the recorded interactions that have not been
+// replayed so far, as "<method> <url>". It is empty unless the Releaser was
+// created with Options.ReplayDir.
+func (r Releaser) UnusedInteractions() []string {
+	if r.client.replayer == nil {
+		return nil
+	}
+	return r.client.replayer.Unused()
+}
+
+// apiURLs returns the REST API base URL and the upload URL, both with a
+// trailing slash.
+func apiURLs(opts Options) (string, string, error) {
+	if opts.BaseURL == "" {
+		if opts.UploadURL != "" {
+			return "", "", errors.New("the upload URL requires a base URL")
+		}
+		gh := github.NewClient(nil)
+		return gh.BaseURL.String(), gh.UploadURL.String(), nil
+	}
+
+	base, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return "", "", fmt.Errorf("base URL: %w", err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	if opts.UploadURL != "" {
+		upload, err := url.Parse(opts.UploadURL)
+		if err != nil {
+			return "", "", fmt.Errorf("upload URL: %w", err)
+		}
+		return base.String(), upload.String(), nil
+	}
+
+	upload := *base
+	if prefix, ok := strings.CutSuffix(base.Path, "/api/v3/"); ok {
+		upload.Path = prefix + "/api/uploads/"
+	}
+	return base.String(), upload.String(), nil
+}
+
+// NewClient returns a Client backed by c.
+func NewClient(c *github.Client) *Client {
+	return &Client{
+		Repositories: repositoriesService{c.Repositories, c},
+		Git:          c.Git,
+		PullRequests: pullRequestsService{c.PullRequests, c},
+		Issues:       c.Issues,
+		Checks:       c.Checks,
+		GraphQL:      graphQLService{c, graphQLURL(c.BaseURL)},
+	}
+}
+
+// repositoriesService adds pagination to CompareCommits, which the go-github
+// version in use does not support.
+type repositoriesService struct {
+	*github.RepositoriesService
+	client *github.Client
+}
+
+func (s repositoriesService) CompareCommits(ctx context.Context, owner, repo, base, head string, opt *github.ListOptions) (*github.CommitsComparison, *github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/compare/%v...%v", owner, repo, base, head)
+	if opt != nil {
+		u += fmt.Sprintf("?per_page=%d&page=%d", opt.PerPage, opt.Page)
+	}
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cmp github.CommitsComparison
+	resp, err := s.client.Do(ctx, req, &cmp)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &cmp, resp, nil
+}
+
+// pullRequestsService adds ListPullRequestsWithCommit, which the go-github
+// version in use does not implement.
+type pullRequestsService struct {
+	*github.PullRequestsService
+	client *github.Client
+}
+
+func (s pullRequestsService) ListPullRequestsWithCommit(ctx context.Context, owner, repo, sha string, opt *github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/commits/%v/pulls", owner, repo, sha)
+	if opt != nil {
+		u += fmt.Sprintf("?per_page=%d&page=%d", opt.PerPage, opt.Page)
+	}
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.groot-preview+json")
+
+	var prs []*github.PullRequest
+	resp, err := s.client.Do(ctx, req, &prs)
+	if err != nil {
+		return nil, resp, err
+	}
+	return prs, resp, nil
+}
+
+// graphQLService sends queries to the GraphQL endpoint at url.
+type graphQLService struct {
+	client *github.Client
+	url    string
+}
+
+// graphQLURL returns the GraphQL endpoint of the REST API at base. GitHub
+// Enterprise serves the REST API below "/api/v3/" and GraphQL at
+// "/api/graphql".
+func graphQLURL(base *url.URL) string {
+	u := *base
+	if prefix, ok := strings.CutSuffix(u.Path, "/api/v3/"); ok {
+		u.Path = prefix + "/api/graphql"
+		return u.String()
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/graphql"
+	return u.String()
+}
+
+func (s graphQLService) Query(ctx context.Context, query string, variables map[string]any, result any) error {
+	body := struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables,omitempty"`
+	}{query, variables}
+
+	req, err := s.client.NewRequest("POST", s.url, body)
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := s.client.Do(ctx, req, &res); err != nil {
+		return err
+	}
+
+	if len(res.Errors) != 0 {
+		var msgs []string
+		for _, e := range res.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("GraphQL: %s", strings.Join(msgs, "; "))
+	}
+	return json.Unmarshal(res.Data, result)
+}
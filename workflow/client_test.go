@@ -0,0 +1,67 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/github"
+)
+
+func TestGraphQLQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/graphql" {
+			http.NotFound(w, req)
+			return
+		}
+
+		var body struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if body.Variables["repo"] != "collectd" {
+			fmt.Fprintf(w, `{"data":null,"errors":[{"message":"Could not resolve to a Repository with the name '%s'."}]}`, body.Variables["repo"])
+			return
+		}
+		if !strings.Contains(body.Query, "pr42: pullRequest(number: 42)") {
+			t.Errorf("query = %q, want pull request #42", body.Query)
+		}
+		fmt.Fprint(w, `{"data":{"repository":{"pr42":{"number":42,"title":"Fix foo","state":"MERGED","mergedAt":"2024-01-02T03:04:05Z","author":{"login":"octo"},"labels":{"nodes":[{"name":"Fix"}]}}}}}`)
+	}))
+	defer srv.Close()
+
+	gh := github.NewClient(srv.Client())
+	gh.BaseURL, _ = url.Parse(srv.URL + "/")
+	c := NewClient(gh)
+
+	var res struct {
+		Repository map[string]*graphQLPullRequest `json:"repository"`
+	}
+	vars := map[string]any{"owner": "collectd", "repo": "collectd"}
+	if err := c.GraphQL.Query(context.Background(), pullRequestsQuery([]int{42}), vars, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	pr := res.Repository["pr42"].PullRequest()
+	got := []any{pr.GetNumber(), pr.GetTitle(), pr.GetState(), pr.GetMerged(), pr.GetUser().GetLogin(), pr.Labels[0].GetName()}
+	want := []any{42, "Fix foo", "closed", true, "octo", "Fix"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("PullRequest() differs (-want/+got):\n%s", diff)
+	}
+
+	vars["repo"] = "other"
+	if err := c.GraphQL.Query(context.Background(), pullRequestsQuery([]int{42}), vars, &res); err == nil || !strings.Contains(err.Error(), "Could not resolve") {
+		t.Errorf("Query() = %v, want the error reported in the response", err)
+	}
+}
@@ -0,0 +1,557 @@
+// Package fakegithub implements workflow.Client in memory. A Repo models a
+// single GitHub repository with branches, files, tags, releases, pull
+// requests, labels and checks, so that the release workflow can be tested end
+// to end without network access.
+//
+// Only lightweight tags are modeled; Git.GetTag always fails. GraphQL queries
+// are limited to fetching pull requests by number.
+package fakegithub
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/collectd/releaser/workflow"
+	"github.com/google/go-github/github"
+)
+
+// MergeMethod is the way a pull request is merged.
+type MergeMethod int
+
+const (
+	// MergeCommit creates a commit on a topic branch and merges it with a
+	// "Merge pull request #N from …" merge commit.
+	MergeCommit MergeMethod = iota
+	// Squash creates a single commit with the subject "<title> (#N)".
+	Squash
+	// Rebase creates a single commit with the pull request's title as
+	// subject, like "Rebase and merge" does.
+	Rebase
+)
+
+type commit struct {
+	seq     int
+	sha     string
+	message string
+	tree    string
+	parents []string
+}
+
+// Repo is an in-memory GitHub repository. All methods are safe for
+// concurrent use.
+type Repo struct {
+	Owner, Name string
+
+	mu        sync.Mutex
+	seq       int
+	commits   map[string]*commit
+	trees     map[string]map[string]string
+	branches  map[string]string
+	tags      map[string]string
+	releases  []*github.RepositoryRelease
+	pulls     map[int]*github.PullRequest
+	pullSHAs  map[int][]string
+	labels    []string
+	statuses  map[string][]github.RepoStatus
+	checkRuns map[string][]*github.CheckRun
+	comments  map[int][]*github.IssueComment
+	failures  map[string][]error
+	calls     map[string]int
+	// lastReport is the time of the last status or check run.
+	lastReport time.Time
+}
+
+// New returns an empty repository.
+func New(owner, name string) *Repo {
+	return &Repo{
+		Owner:     owner,
+		Name:      name,
+		commits:   make(map[string]*commit),
+		trees:     make(map[string]map[string]string),
+		branches:  make(map[string]string),
+		tags:      make(map[string]string),
+		pulls:     make(map[int]*github.PullRequest),
+		pullSHAs:  make(map[int][]string),
+		statuses:  make(map[string][]github.RepoStatus),
+		checkRuns: make(map[string][]*github.CheckRun),
+		comments:  make(map[int][]*github.IssueComment),
+		failures:  make(map[string][]error),
+		calls:     make(map[string]int),
+	}
+}
+
+// Client returns a workflow.Client accessing r.
+func (r *Repo) Client() *workflow.Client {
+	return &workflow.Client{
+		Repositories: repositories{r},
+		Git:          git{r},
+		PullRequests: pullRequests{r},
+		Issues:       issues{r},
+		Checks:       checks{r},
+		GraphQL:      graphQL{r},
+	}
+}
+
+// Commit adds a commit changing files to branch, creating the branch if it
+// does not exist, and returns its SHA.
+func (r *Repo) Commit(branch, message string, files map[string]string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var parents []string
+	if head, ok := r.branches[branch]; ok {
+		parents = []string{head}
+	}
+
+	sha := r.commit(message, r.tree(parents, files), parents...)
+	r.branches[branch] = sha
+	return sha
+}
+
+// Merge merges the pull request pr into the branch named by pr.Base.Ref,
+// changing files, and returns the SHA of the new branch head. Number and
+// Title of pr must be set. MergedAt, MergeCommitSHA and State are set by
+// Merge.
+func (r *Repo) Merge(pr *github.PullRequest, method MergeMethod, files map[string]string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	branch := pr.GetBase().GetRef()
+	head, ok := r.branches[branch]
+	if !ok {
+		panic(fmt.Sprintf("branch %q does not exist", branch))
+	}
+
+	var sha string
+	switch method {
+	case MergeCommit:
+		topic := r.commit(pr.GetTitle(), r.tree([]string{head}, files), head)
+		sha = r.commit(fmt.Sprintf("Merge pull request #%d from %s/topic\n\n%s", pr.GetNumber(), pr.GetUser().GetLogin(), pr.GetTitle()), r.commits[topic].tree, head, topic)
+		r.pullSHAs[pr.GetNumber()] = []string{topic, sha}
+	case Squash:
+		sha = r.commit(fmt.Sprintf("%s (#%d)", pr.GetTitle(), pr.GetNumber()), r.tree([]string{head}, files), head)
+		r.pullSHAs[pr.GetNumber()] = []string{sha}
+	case Rebase:
+		sha = r.commit(pr.GetTitle(), r.tree([]string{head}, files), head)
+		r.pullSHAs[pr.GetNumber()] = []string{sha}
+	}
+	r.branches[branch] = sha
+
+	now := time.Now()
+	pr.State = github.String("closed")
+	pr.Merged = github.Bool(true)
+	pr.MergedAt = &now
+	pr.UpdatedAt = &now
+	pr.MergeCommitSHA = github.String(sha)
+	r.pulls[pr.GetNumber()] = pr
+
+	return sha
+}
+
+// Branch creates the branch name pointing to ref, a branch name, tag name or
+// commit SHA.
+func (r *Repo) Branch(name, ref string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sha, ok := r.resolve(ref)
+	if !ok {
+		panic(fmt.Sprintf("ref %q does not exist", ref))
+	}
+	r.branches[name] = sha
+}
+
+// MergeBranch merges the branch from into the branch into with a merge commit
+// that is not associated with a pull request, e.g. "Merge branch
+// 'collectd-5.12' into collectd-6.0", and returns its SHA. The tree of into is
+// kept.
+func (r *Repo) MergeBranch(from, into string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, ok := r.branches[into]
+	if !ok {
+		panic(fmt.Sprintf("branch %q does not exist", into))
+	}
+	side, ok := r.branches[from]
+	if !ok {
+		panic(fmt.Sprintf("branch %q does not exist", from))
+	}
+
+	sha := r.commit(fmt.Sprintf("Merge branch '%s' into %s", from, into), r.commits[head].tree, head, side)
+	r.branches[into] = sha
+	return sha
+}
+
+// UpdatePR calls update with the pull request number and sets its
+// UpdatedAt time.
+func (r *Repo) UpdatePR(number int, update func(*github.PullRequest)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pr, ok := r.pulls[number]
+	if !ok {
+		panic(fmt.Sprintf("pull request #%d does not exist", number))
+	}
+	update(pr)
+	// Ensure the update time changes even on platforms with a coarse clock.
+	now := time.Now()
+	if !now.After(pr.GetUpdatedAt()) {
+		now = pr.GetUpdatedAt().Add(time.Millisecond)
+	}
+	pr.UpdatedAt = &now
+}
+
+// Tag creates a lightweight tag on ref, a branch name, tag name or commit
+// SHA.
+func (r *Repo) Tag(tag, ref string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sha, ok := r.resolve(ref)
+	if !ok {
+		panic(fmt.Sprintf("ref %q does not exist", ref))
+	}
+	r.tags[tag] = sha
+}
+
+// Label creates labels.
+func (r *Repo) Label(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.labels = append(r.labels, names...)
+}
+
+// Status sets the commit status context on sha to state, e.g. "success".
+func (r *Repo) Status(sha, context, state string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var statuses []github.RepoStatus
+	for _, s := range r.statuses[sha] {
+		if s.GetContext() != context {
+			statuses = append(statuses, s)
+		}
+	}
+	now := r.reportTime()
+	r.statuses[sha] = append(statuses, github.RepoStatus{
+		Context:   github.String(context),
+		State:     github.String(state),
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	})
+}
+
+// CheckRun adds a check run to sha. conclusion is ignored unless status is
+// "completed". Like GitHub, the check runs of a commit are listed newest
+// first, and re-running a check adds another run with the same name.
+func (r *Repo) CheckRun(sha, name, status, conclusion string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.reportTime()
+	run := &github.CheckRun{
+		Name:      github.String(name),
+		HeadSHA:   github.String(sha),
+		Status:    github.String(status),
+		StartedAt: &github.Timestamp{Time: now},
+	}
+	if status == "completed" {
+		run.Conclusion = github.String(conclusion)
+		run.CompletedAt = &github.Timestamp{Time: now}
+	}
+	r.checkRuns[sha] = append([]*github.CheckRun{run}, r.checkRuns[sha]...)
+}
+
+// reportTime returns the time of a new status or check run, which is after
+// all previous ones even on platforms with a coarse clock. r.mu must be held.
+func (r *Repo) reportTime() time.Time {
+	now := time.Now()
+	if !now.After(r.lastReport) {
+		now = r.lastReport.Add(time.Millisecond)
+	}
+	r.lastReport = now
+	return now
+}
+
+// Calls returns the number of calls of method, e.g. "PullRequests.Get".
+func (r *Repo) Calls(method string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.calls[method]
+}
+
+// FailOnce makes the next call of method, e.g. "Repositories.CreateRelease",
+// return err without any effect.
+func (r *Repo) FailOnce(method string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures[method] = append(r.failures[method], err)
+}
+
+// Comments returns the bodies of the comments on the pull request or issue
+// number.
+func (r *Repo) Comments(number int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ret []string
+	for _, c := range r.comments[number] {
+		ret = append(ret, c.GetBody())
+	}
+	return ret
+}
+
+// Head returns the SHA of the head of branch, or the empty string if the
+// branch does not exist.
+func (r *Repo) Head(branch string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.branches[branch]
+}
+
+// TagCommit returns the SHA of the commit tag points to, or the empty string
+// if the tag does not exist.
+func (r *Repo) TagCommit(tag string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.tags[tag]
+}
+
+// File returns the content of path at ref.
+func (r *Repo) File(ref, path string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return "", false
+	}
+	content, ok := r.trees[r.commits[sha].tree][path]
+	return content, ok
+}
+
+// Message returns the commit message of sha.
+func (r *Repo) Message(sha string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.commits[sha]; ok {
+		return c.message
+	}
+	return ""
+}
+
+// Releases returns all releases, newest first.
+func (r *Repo) Releases() []*github.RepositoryRelease {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ret []*github.RepositoryRelease
+	for i := len(r.releases) - 1; i >= 0; i-- {
+		rel := *r.releases[i]
+		ret = append(ret, &rel)
+	}
+	return ret
+}
+
+// AddRelease creates a release and its tag on target, a branch name or
+// commit SHA.
+func (r *Repo) AddRelease(tag, name, target string, prerelease bool) {
+	_, _, err := repositories{r}.CreateRelease(context.Background(), r.Owner, r.Name, &github.RepositoryRelease{
+		TagName:         github.String(tag),
+		TargetCommitish: github.String(target),
+		Name:            github.String(name),
+		Prerelease:      github.Bool(prerelease),
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// commit creates a commit. r.mu must be held.
+func (r *Repo) commit(message, tree string, parents ...string) string {
+	r.seq++
+	h := sha1.New()
+	fmt.Fprintf(h, "commit %d\ntree %s\nparents %s\n\n%s", r.seq, tree, strings.Join(parents, " "), message)
+	sha := hex.EncodeToString(h.Sum(nil))
+
+	r.commits[sha] = &commit{
+		seq:     r.seq,
+		sha:     sha,
+		message: message,
+		tree:    tree,
+		parents: parents,
+	}
+	return sha
+}
+
+// tree creates the tree of the first parent with files changed. r.mu must be
+// held.
+func (r *Repo) tree(parents []string, files map[string]string) string {
+	var base string
+	if len(parents) != 0 {
+		base = r.commits[parents[0]].tree
+	}
+	return r.putTree(base, files)
+}
+
+// putTree stores the tree base with files changed and returns its SHA. r.mu
+// must be held.
+func (r *Repo) putTree(base string, files map[string]string) string {
+	t := make(map[string]string)
+	for path, content := range r.trees[base] {
+		t[path] = content
+	}
+	for path, content := range files {
+		t[path] = content
+	}
+
+	var paths []string
+	for path := range t {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	h := sha1.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s\x00%s\x00", path, t[path])
+	}
+	sha := hex.EncodeToString(h.Sum(nil))
+
+	r.trees[sha] = t
+	return sha
+}
+
+// resolve returns the commit SHA ref refers to. ref is a branch or tag name,
+// optionally prefixed with "heads/" or "tags/", or a commit SHA. r.mu must be
+// held.
+func (r *Repo) resolve(ref string) (string, bool) {
+	ref = strings.TrimPrefix(ref, "refs/")
+	if name, ok := strings.CutPrefix(ref, "heads/"); ok {
+		sha, ok := r.branches[name]
+		return sha, ok
+	}
+	if name, ok := strings.CutPrefix(ref, "tags/"); ok {
+		sha, ok := r.tags[name]
+		return sha, ok
+	}
+
+	if sha, ok := r.branches[ref]; ok {
+		return sha, true
+	}
+	if sha, ok := r.tags[ref]; ok {
+		return sha, true
+	}
+	if _, ok := r.commits[ref]; ok {
+		return ref, true
+	}
+	return "", false
+}
+
+// ancestors returns the set of commits reachable from sha, including sha.
+// r.mu must be held.
+func (r *Repo) ancestors(sha string) map[string]bool {
+	ret := make(map[string]bool)
+	queue := []string{sha}
+	for len(queue) != 0 {
+		sha, queue = queue[0], queue[1:]
+		if ret[sha] {
+			continue
+		}
+		ret[sha] = true
+		queue = append(queue, r.commits[sha].parents...)
+	}
+	return ret
+}
+
+// call checks owner and repo and returns an injected failure for method, if
+// any. r.mu must be held.
+func (r *Repo) call(method, owner, repo string) error {
+	if owner != r.Owner || repo != r.Name {
+		return notFound("repos/%s/%s", owner, repo)
+	}
+	r.calls[method]++
+
+	if errs := r.failures[method]; len(errs) != 0 {
+		r.failures[method] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+func (r *Repo) gitCommit(sha string) *github.Commit {
+	c := r.commits[sha]
+	ret := &github.Commit{
+		SHA:     github.String(sha),
+		Message: github.String(c.message),
+		Tree: &github.Tree{
+			SHA: github.String(c.tree),
+		},
+		HTMLURL: github.String(fmt.Sprintf("https://github.com/%s/%s/commit/%s", r.Owner, r.Name, sha)),
+	}
+	for _, p := range c.parents {
+		ret.Parents = append(ret.Parents, github.Commit{SHA: github.String(p)})
+	}
+	return ret
+}
+
+func newResponse() *github.Response {
+	return &github.Response{
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+		},
+	}
+}
+
+func errorResponse(code int, format string, args ...any) *github.ErrorResponse {
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/"+fmt.Sprintf(format, args...), nil)
+	return &github.ErrorResponse{
+		Response: &http.Response{
+			StatusCode: code,
+			Request:    req,
+		},
+		Message: http.StatusText(code),
+	}
+}
+
+func notFound(format string, args ...any) *github.ErrorResponse {
+	return errorResponse(http.StatusNotFound, format, args...)
+}
+
+// page returns the page of items selected by opt.
+func page[T any](items []T, opt *github.ListOptions) ([]T, *github.Response) {
+	resp := newResponse()
+	if opt == nil || opt.PerPage <= 0 {
+		return items, resp
+	}
+
+	n := opt.Page
+	if n < 1 {
+		n = 1
+	}
+	start := (n - 1) * opt.PerPage
+	if start >= len(items) {
+		return nil, resp
+	}
+	end := start + opt.PerPage
+	if end < len(items) {
+		resp.NextPage = n + 1
+		resp.LastPage = (len(items) + opt.PerPage - 1) / opt.PerPage
+	} else {
+		end = len(items)
+	}
+	return items[start:end], resp
+}
@@ -0,0 +1,641 @@
+package fakegithub
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+type repositories struct{ r *Repo }
+
+func (s repositories) GetBranch(_ context.Context, owner, repo, branch string) (*github.Branch, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Repositories.GetBranch", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	sha, ok := r.branches[branch]
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/branches/%s", owner, repo, branch)
+	}
+
+	return &github.Branch{
+		Name: github.String(branch),
+		Commit: &github.RepositoryCommit{
+			SHA:    github.String(sha),
+			Commit: r.gitCommit(sha),
+		},
+	}, newResponse(), nil
+}
+
+func (s repositories) GetContents(_ context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Repositories.GetContents", owner, repo); err != nil {
+		return nil, nil, nil, err
+	}
+
+	ref := "master"
+	if opt != nil && opt.Ref != "" {
+		ref = opt.Ref
+	}
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return nil, nil, nil, notFound("repos/%s/%s/contents/%s?ref=%s", owner, repo, path, ref)
+	}
+	content, ok := r.trees[r.commits[sha].tree][path]
+	if !ok {
+		return nil, nil, nil, notFound("repos/%s/%s/contents/%s?ref=%s", owner, repo, path, ref)
+	}
+
+	return &github.RepositoryContent{
+		Type:     github.String("file"),
+		Path:     github.String(path),
+		Size:     github.Int(len(content)),
+		Encoding: github.String("base64"),
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+	}, nil, newResponse(), nil
+}
+
+func (s repositories) GetCombinedStatus(_ context.Context, owner, repo, ref string, opt *github.ListOptions) (*github.CombinedStatus, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Repositories.GetCombinedStatus", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/commits/%s/status", owner, repo, ref)
+	}
+
+	state := "success"
+	for _, st := range r.statuses[sha] {
+		switch st.GetState() {
+		case "pending":
+			if state == "success" {
+				state = "pending"
+			}
+		case "success":
+		default:
+			state = "failure"
+		}
+	}
+	if len(r.statuses[sha]) == 0 {
+		state = "pending"
+	}
+
+	statuses, resp := page(r.statuses[sha], opt)
+	return &github.CombinedStatus{
+		State:      github.String(state),
+		SHA:        github.String(sha),
+		TotalCount: github.Int(len(r.statuses[sha])),
+		Statuses:   statuses,
+	}, resp, nil
+}
+
+func (s repositories) CompareCommits(_ context.Context, owner, repo, base, head string, opt *github.ListOptions) (*github.CommitsComparison, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Repositories.CompareCommits", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	baseSHA, ok := r.resolve(base)
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/compare/%s...%s", owner, repo, base, head)
+	}
+	headSHA, ok := r.resolve(head)
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/compare/%s...%s", owner, repo, base, head)
+	}
+
+	exclude := r.ancestors(baseSHA)
+	var commits []*commit
+	for sha := range r.ancestors(headSHA) {
+		if !exclude[sha] {
+			commits = append(commits, r.commits[sha])
+		}
+	}
+	// Parents are always created before their children.
+	sort.Slice(commits, func(i, j int) bool {
+		return commits[i].seq < commits[j].seq
+	})
+
+	var all []github.RepositoryCommit
+	for _, c := range commits {
+		gc := r.gitCommit(c.sha)
+		all = append(all, github.RepositoryCommit{
+			SHA:     gc.SHA,
+			Commit:  gc,
+			Parents: gc.Parents,
+		})
+	}
+
+	status := "ahead"
+	if len(all) == 0 {
+		status = "identical"
+	}
+	pageCommits, resp := page(all, opt)
+	return &github.CommitsComparison{
+		Status:       github.String(status),
+		AheadBy:      github.Int(len(all)),
+		TotalCommits: github.Int(len(all)),
+		Commits:      pageCommits,
+	}, resp, nil
+}
+
+func (s repositories) ListReleases(_ context.Context, owner, repo string, opt *github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Repositories.ListReleases", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	var all []*github.RepositoryRelease
+	for i := len(r.releases) - 1; i >= 0; i-- {
+		rel := *r.releases[i]
+		all = append(all, &rel)
+	}
+	releases, resp := page(all, opt)
+	return releases, resp, nil
+}
+
+func (s repositories) GetReleaseByTag(_ context.Context, owner, repo, tag string) (*github.RepositoryRelease, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Repositories.GetReleaseByTag", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	for _, rel := range r.releases {
+		if rel.GetTagName() == tag {
+			ret := *rel
+			return &ret, newResponse(), nil
+		}
+	}
+	return nil, nil, notFound("repos/%s/%s/releases/tags/%s", owner, repo, tag)
+}
+
+func (s repositories) CreateRelease(_ context.Context, owner, repo string, release *github.RepositoryRelease) (*github.RepositoryRelease, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Repositories.CreateRelease", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	tag := release.GetTagName()
+	for _, rel := range r.releases {
+		if rel.GetTagName() == tag {
+			return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/releases", owner, repo)
+		}
+	}
+
+	if _, ok := r.tags[tag]; !ok {
+		sha, ok := r.resolve(release.GetTargetCommitish())
+		if !ok {
+			return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/releases", owner, repo)
+		}
+		r.tags[tag] = sha
+	}
+
+	now := github.Timestamp{Time: time.Now()}
+	rel := *release
+	rel.ID = github.Int64(int64(len(r.releases) + 1))
+	rel.HTMLURL = github.String(fmt.Sprintf("https://github.com/%s/%s/releases/tag/%s", owner, repo, tag))
+	rel.CreatedAt = &now
+	rel.PublishedAt = &now
+	r.releases = append(r.releases, &rel)
+
+	ret := rel
+	return &ret, newResponse(), nil
+}
+
+type git struct{ r *Repo }
+
+func (s git) GetCommit(_ context.Context, owner, repo, sha string) (*github.Commit, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Git.GetCommit", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	if _, ok := r.commits[sha]; !ok {
+		return nil, nil, notFound("repos/%s/%s/git/commits/%s", owner, repo, sha)
+	}
+	return r.gitCommit(sha), newResponse(), nil
+}
+
+func (s git) CreateTree(_ context.Context, owner, repo, baseTree string, entries []github.TreeEntry) (*github.Tree, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Git.CreateTree", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	if _, ok := r.trees[baseTree]; baseTree != "" && !ok {
+		return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/git/trees", owner, repo)
+	}
+
+	files := make(map[string]string)
+	for _, e := range entries {
+		if e.Content == nil {
+			return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/git/trees", owner, repo)
+		}
+		files[e.GetPath()] = e.GetContent()
+	}
+
+	return &github.Tree{
+		SHA: github.String(r.putTree(baseTree, files)),
+	}, newResponse(), nil
+}
+
+func (s git) CreateCommit(_ context.Context, owner, repo string, c *github.Commit) (*github.Commit, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Git.CreateCommit", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	if _, ok := r.trees[c.GetTree().GetSHA()]; !ok {
+		return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/git/commits", owner, repo)
+	}
+	var parents []string
+	for _, p := range c.Parents {
+		if _, ok := r.commits[p.GetSHA()]; !ok {
+			return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/git/commits", owner, repo)
+		}
+		parents = append(parents, p.GetSHA())
+	}
+
+	sha := r.commit(c.GetMessage(), c.GetTree().GetSHA(), parents...)
+	return r.gitCommit(sha), newResponse(), nil
+}
+
+func (s git) GetRef(_ context.Context, owner, repo, ref string) (*github.Reference, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Git.GetRef", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	ref = strings.TrimPrefix(ref, "refs/")
+	if !strings.HasPrefix(ref, "heads/") && !strings.HasPrefix(ref, "tags/") {
+		return nil, nil, notFound("repos/%s/%s/git/refs/%s", owner, repo, ref)
+	}
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/git/refs/%s", owner, repo, ref)
+	}
+
+	return &github.Reference{
+		Ref: github.String("refs/" + ref),
+		Object: &github.GitObject{
+			Type: github.String("commit"),
+			SHA:  github.String(sha),
+		},
+	}, newResponse(), nil
+}
+
+func (s git) UpdateRef(_ context.Context, owner, repo string, ref *github.Reference, force bool) (*github.Reference, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Git.UpdateRef", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	name := strings.TrimPrefix(ref.GetRef(), "refs/")
+	sha := ref.GetObject().GetSHA()
+	if _, ok := r.commits[sha]; !ok {
+		return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/git/refs/%s", owner, repo, name)
+	}
+
+	var refs map[string]string
+	switch {
+	case strings.HasPrefix(name, "heads/"):
+		refs = r.branches
+	case strings.HasPrefix(name, "tags/"):
+		refs = r.tags
+	default:
+		return nil, nil, notFound("repos/%s/%s/git/refs/%s", owner, repo, name)
+	}
+	short := name[strings.Index(name, "/")+1:]
+
+	old, ok := refs[short]
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/git/refs/%s", owner, repo, name)
+	}
+	if !force && !r.ancestors(sha)[old] {
+		// not a fast-forward
+		return nil, nil, errorResponse(http.StatusUnprocessableEntity, "repos/%s/%s/git/refs/%s", owner, repo, name)
+	}
+	refs[short] = sha
+
+	return &github.Reference{
+		Ref: github.String("refs/" + name),
+		Object: &github.GitObject{
+			Type: github.String("commit"),
+			SHA:  github.String(sha),
+		},
+	}, newResponse(), nil
+}
+
+func (s git) GetTag(_ context.Context, owner, repo, sha string) (*github.Tag, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Git.GetTag", owner, repo); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, notFound("repos/%s/%s/git/tags/%s", owner, repo, sha)
+}
+
+type pullRequests struct{ r *Repo }
+
+func (s pullRequests) Get(_ context.Context, owner, repo string, number int) (*github.PullRequest, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("PullRequests.Get", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	pr, ok := r.pulls[number]
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/pulls/%d", owner, repo, number)
+	}
+	ret := *pr
+	return &ret, newResponse(), nil
+}
+
+func (s pullRequests) List(_ context.Context, owner, repo string, opt *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("PullRequests.List", owner, repo); err != nil {
+		return nil, nil, err
+	}
+	if opt == nil {
+		opt = &github.PullRequestListOptions{}
+	}
+
+	var all []*github.PullRequest
+	for _, pr := range r.pulls {
+		if opt.State != "all" && pr.GetState() != opt.State && !(opt.State == "" && pr.GetState() == "open") {
+			continue
+		}
+		if opt.Base != "" && pr.GetBase().GetRef() != opt.Base {
+			continue
+		}
+		ret := *pr
+		all = append(all, &ret)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if opt.Sort == "updated" && !a.GetUpdatedAt().Equal(b.GetUpdatedAt()) {
+			return a.GetUpdatedAt().Before(b.GetUpdatedAt())
+		}
+		return a.GetNumber() < b.GetNumber()
+	})
+	if opt.Direction == "desc" {
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+	}
+
+	prs, resp := page(all, &opt.ListOptions)
+	return prs, resp, nil
+}
+
+func (s pullRequests) ListPullRequestsWithCommit(_ context.Context, owner, repo, sha string, opt *github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("PullRequests.ListPullRequestsWithCommit", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	var numbers []int
+	for n, shas := range r.pullSHAs {
+		for _, s := range shas {
+			if s == sha {
+				numbers = append(numbers, n)
+				break
+			}
+		}
+	}
+	sort.Ints(numbers)
+
+	var all []*github.PullRequest
+	for _, n := range numbers {
+		pr := *r.pulls[n]
+		all = append(all, &pr)
+	}
+	prs, resp := page(all, opt)
+	return prs, resp, nil
+}
+
+type issues struct{ r *Repo }
+
+func (s issues) ListLabels(_ context.Context, owner, repo string, opt *github.ListOptions) ([]*github.Label, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Issues.ListLabels", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	var all []*github.Label
+	for _, name := range r.labels {
+		all = append(all, &github.Label{Name: github.String(name)})
+	}
+	labels, resp := page(all, opt)
+	return labels, resp, nil
+}
+
+func (s issues) ListComments(_ context.Context, owner, repo string, number int, opt *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Issues.ListComments", owner, repo); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := r.pulls[number]; !ok {
+		return nil, nil, notFound("repos/%s/%s/issues/%d/comments", owner, repo, number)
+	}
+
+	var listOpt *github.ListOptions
+	if opt != nil {
+		listOpt = &opt.ListOptions
+	}
+	comments, resp := page(r.comments[number], listOpt)
+	return comments, resp, nil
+}
+
+func (s issues) CreateComment(_ context.Context, owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Issues.CreateComment", owner, repo); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := r.pulls[number]; !ok {
+		return nil, nil, notFound("repos/%s/%s/issues/%d/comments", owner, repo, number)
+	}
+
+	c := &github.IssueComment{
+		ID:   github.Int64(int64(len(r.comments[number]) + 1)),
+		Body: github.String(comment.GetBody()),
+	}
+	r.comments[number] = append(r.comments[number], c)
+	return c, newResponse(), nil
+}
+
+type checks struct{ r *Repo }
+
+func (s checks) ListCheckRunsForRef(_ context.Context, owner, repo, ref string, opt *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error) {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.call("Checks.ListCheckRunsForRef", owner, repo); err != nil {
+		return nil, nil, err
+	}
+
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return nil, nil, notFound("repos/%s/%s/commits/%s/check-runs", owner, repo, ref)
+	}
+
+	var listOpt *github.ListOptions
+	if opt != nil {
+		listOpt = &opt.ListOptions
+	}
+	runs, resp := page(r.checkRuns[sha], listOpt)
+	return &github.ListCheckRunsResults{
+		Total:     github.Int(len(r.checkRuns[sha])),
+		CheckRuns: runs,
+	}, resp, nil
+}
+
+type graphQL struct{ r *Repo }
+
+// pullRequestRE matches the aliased pull request fields of a query.
+var pullRequestRE = regexp.MustCompile(`(\w+): pullRequest\(number: (\d+)\)`)
+
+// Query supports queries for pull requests by number, selected as
+// "<alias>: pullRequest(number: N)" in the repository given by the "owner"
+// and "repo" variables.
+func (s graphQL) Query(_ context.Context, query string, variables map[string]any, result any) error {
+	r := s.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owner, _ := variables["owner"].(string)
+	repo, _ := variables["repo"].(string)
+	if err := r.call("GraphQL.Query", owner, repo); err != nil {
+		return err
+	}
+
+	matches := pullRequestRE.FindAllStringSubmatch(query, -1)
+	if len(matches) == 0 {
+		return fmt.Errorf("GraphQL: unsupported query %q", query)
+	}
+
+	repository := make(map[string]any)
+	for _, m := range matches {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return err
+		}
+		pr, ok := r.pulls[n]
+		if !ok {
+			return fmt.Errorf("GraphQL: Could not resolve to a PullRequest with the number of %d.", n)
+		}
+		repository[m[1]] = graphQLPullRequest(pr)
+	}
+
+	data, err := json.Marshal(map[string]any{"repository": repository})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func graphQLPullRequest(pr *github.PullRequest) map[string]any {
+	state := "OPEN"
+	switch {
+	case pr.MergedAt != nil:
+		state = "MERGED"
+	case pr.GetState() == "closed":
+		state = "CLOSED"
+	}
+
+	var labels []map[string]any
+	for _, l := range pr.Labels {
+		labels = append(labels, map[string]any{"name": l.GetName()})
+	}
+
+	ret := map[string]any{
+		"number":      pr.GetNumber(),
+		"title":       pr.GetTitle(),
+		"body":        pr.GetBody(),
+		"url":         pr.GetHTMLURL(),
+		"state":       state,
+		"updatedAt":   pr.GetUpdatedAt(),
+		"mergedAt":    pr.MergedAt,
+		"baseRefName": pr.GetBase().GetRef(),
+		"author":      nil,
+		"mergeCommit": nil,
+		"labels":      map[string]any{"nodes": labels},
+	}
+	if pr.User != nil {
+		ret["author"] = map[string]any{"login": pr.GetUser().GetLogin()}
+	}
+	if pr.MergeCommitSHA != nil {
+		ret["mergeCommit"] = map[string]any{"oid": pr.GetMergeCommitSHA()}
+	}
+	return ret
+}
@@ -0,0 +1,357 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// DefaultConcurrency is the number of pull requests fetched at the same time
+// if Options.Concurrency is not set.
+const DefaultConcurrency = 8
+
+// fetchPullRequests returns the pull requests ids, in the same order. Pull
+// requests that have not been updated since they were cached are read from
+// the cache. The others are fetched with GraphQL queries if r.fetcher is
+// "graphql", or with up to r.concurrency REST calls at the same time.
+func (r Releaser) fetchPullRequests(ctx context.Context, ids []int) ([]*github.PullRequest, error) {
+	ret := make([]*github.PullRequest, len(ids))
+
+	cached, err := r.cachedPullRequests(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var todo []int
+	for i, id := range ids {
+		if pr, ok := cached[id]; ok {
+			ret[i] = pr
+			continue
+		}
+		todo = append(todo, i)
+	}
+	if len(cached) != 0 {
+		log.Printf("Read %d pull request(s) from the cache, fetching %d", len(ids)-len(todo), len(todo))
+	}
+
+	if r.fetcher == "graphql" {
+		if err := r.fetchGraphQL(ctx, ids, todo, ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		jobs     = make(chan int)
+	)
+	workers := r.concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	for w := 0; w < workers && w < len(todo); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				id := ids[i]
+				pr, _, err := r.client.PullRequests.Get(ctx, r.owner, r.repo, id)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("PullRequests.Get(%q, %q, %d): %w", r.owner, r.repo, id, err)
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+
+				ret[i] = pr
+				if err := r.cache.put(pr); err != nil {
+					log.Printf("Caching pull request #%d failed: %v", id, err)
+				}
+			}
+		}()
+	}
+
+	for _, i := range todo {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// fetchGraphQL fetches the pull requests ids[i] for all i in todo and stores
+// them in ret[i].
+func (r Releaser) fetchGraphQL(ctx context.Context, ids, todo []int, ret []*github.PullRequest) error {
+	var batch []int
+	for _, i := range todo {
+		batch = append(batch, ids[i])
+	}
+
+	prs, err := r.fetchPullRequestsGraphQL(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	for n, i := range todo {
+		ret[i] = prs[n]
+		if err := r.cache.put(prs[n]); err != nil {
+			log.Printf("Caching pull request #%d failed: %v", ids[i], err)
+		}
+	}
+	return nil
+}
+
+// cachedPullRequests returns the cached pull requests among ids that have not
+// been updated since they were cached.
+//
+// Recently updated pull requests are listed until the checkpoint of the
+// previous check is reached: all cached pull requests were current then, and
+// any update since would have been listed. Listed pull requests that have
+// been updated are removed from the cache. Without a checkpoint, the listing
+// goes back to the least recent update time in the cache.
+func (r Releaser) cachedPullRequests(ctx context.Context, ids []int) (map[int]*github.PullRequest, error) {
+	ret := make(map[int]*github.PullRequest)
+	for _, id := range ids {
+		pr := r.cache.get(id)
+		if pr == nil || pr.UpdatedAt == nil {
+			continue
+		}
+		ret[id] = pr
+	}
+	if len(ret) == 0 {
+		return ret, nil
+	}
+
+	since := r.cache.checkpoint()
+	if since.IsZero() {
+		since = r.cache.oldest()
+	}
+
+	opt := github.PullRequestListOptions{
+		State:     "closed",
+		Sort:      "updated",
+		Direction: "desc",
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	var newest time.Time
+	for {
+		prs, resp, err := r.client.PullRequests.List(ctx, r.owner, r.repo, &opt)
+		if err != nil {
+			return nil, fmt.Errorf("PullRequests.List(%q, %q): %w", r.owner, r.repo, err)
+		}
+
+		done := false
+		for _, pr := range prs {
+			if newest.IsZero() {
+				newest = pr.GetUpdatedAt()
+			}
+			if pr.GetUpdatedAt().Before(since) {
+				done = true
+				break
+			}
+
+			c, ok := ret[pr.GetNumber()]
+			if !ok {
+				c = r.cache.get(pr.GetNumber())
+			}
+			if c != nil && !c.GetUpdatedAt().Equal(pr.GetUpdatedAt()) {
+				delete(ret, pr.GetNumber())
+				r.cache.remove(pr.GetNumber())
+			}
+		}
+
+		if done || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	// All remaining cache entries are current as of newest, and so are the
+	// pull requests fetched from now on.
+	if !newest.IsZero() {
+		if err := r.cache.setCheckpoint(newest); err != nil {
+			log.Printf("Caching the checkpoint failed: %v", err)
+		}
+	}
+	return ret, nil
+}
+
+// prCache stores pull requests on disk, one JSON file per pull request. The
+// zero value is a disabled cache.
+type prCache struct {
+	dir string
+}
+
+func newPRCache(dir, owner, repo string) prCache {
+	if dir == "" {
+		return prCache{}
+	}
+	return prCache{
+		dir: filepath.Join(dir, owner, repo, "pulls"),
+	}
+}
+
+func (c prCache) path(number int) string {
+	return filepath.Join(c.dir, strconv.Itoa(number)+".json")
+}
+
+// get returns the cached pull request number, or nil.
+func (c prCache) get(number int) *github.PullRequest {
+	if c.dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path(number))
+	if err != nil {
+		return nil
+	}
+
+	var pr github.PullRequest
+	if err := json.Unmarshal(data, &pr); err != nil {
+		log.Printf("Ignoring invalid cache entry %s: %v", c.path(number), err)
+		return nil
+	}
+	return &pr
+}
+
+// oldest returns the least recent update time of the cached pull requests, or
+// the zero time.
+func (c prCache) oldest() time.Time {
+	if c.dir == "" {
+		return time.Time{}
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return time.Time{}
+	}
+
+	var oldest time.Time
+	for _, e := range entries {
+		number, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		pr := c.get(number)
+		if pr == nil || pr.UpdatedAt == nil {
+			continue
+		}
+		if oldest.IsZero() || pr.UpdatedAt.Before(oldest) {
+			oldest = *pr.UpdatedAt
+		}
+	}
+	return oldest
+}
+
+// remove deletes the cached pull request number.
+func (c prCache) remove(number int) {
+	if c.dir == "" {
+		return
+	}
+	if err := os.Remove(c.path(number)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Removing cache entry %s failed: %v", c.path(number), err)
+	}
+}
+
+func (c prCache) put(pr *github.PullRequest) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	return c.write(c.path(pr.GetNumber()), data)
+}
+
+// checkpointPath is the file storing the checkpoint: the update time of the
+// most recently updated pull request when the cache was last checked.
+func (c prCache) checkpointPath() string {
+	return filepath.Join(c.dir, ".checkpoint")
+}
+
+// checkpoint returns the update time stored by setCheckpoint, or the zero
+// time.
+func (c prCache) checkpoint() time.Time {
+	if c.dir == "" {
+		return time.Time{}
+	}
+
+	data, err := os.ReadFile(c.checkpointPath())
+	if err != nil {
+		return time.Time{}
+	}
+
+	var t time.Time
+	if err := t.UnmarshalText(data); err != nil {
+		log.Printf("Ignoring invalid cache entry %s: %v", c.checkpointPath(), err)
+		return time.Time{}
+	}
+	return t
+}
+
+// setCheckpoint stores the checkpoint t. All cached pull requests must have
+// been current when t was the most recent update time.
+func (c prCache) setCheckpoint(t time.Time) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	data, err := t.MarshalText()
+	if err != nil {
+		return err
+	}
+	return c.write(c.checkpointPath(), data)
+}
+
+// write atomically replaces the file path in the cache directory with data.
+func (c prCache) write(path string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
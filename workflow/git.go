@@ -88,6 +88,10 @@ func (b *GitBranch) GitCommit(ctx context.Context, message string) error {
 		return fmt.Errorf("Git.UpdateRef(%q, %q, %q): %w", b.releaser.owner, b.releaser.repo, b.GetName(), err)
 	}
 
+	b.Branch.Commit = &github.RepositoryCommit{
+		SHA:    commit.SHA,
+		Commit: commit,
+	}
 	b.stage = nil
 	return nil
 }
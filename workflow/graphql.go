@@ -0,0 +1,141 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// graphQLBatchSize is the maximum number of pull requests fetched by a single
+// GraphQL query.
+const graphQLBatchSize = 100
+
+const pullRequestFragment = `fragment pr on PullRequest {
+  number
+  title
+  body
+  url
+  state
+  updatedAt
+  mergedAt
+  baseRefName
+  author { login }
+  mergeCommit { oid }
+  labels(first: 100) { nodes { name } }
+}`
+
+// graphQLPullRequest is the result of pullRequestFragment.
+type graphQLPullRequest struct {
+	Number      int        `json:"number"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	URL         string     `json:"url"`
+	State       string     `json:"state"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	MergedAt    *time.Time `json:"mergedAt"`
+	BaseRefName string     `json:"baseRefName"`
+	Author      *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	MergeCommit *struct {
+		OID string `json:"oid"`
+	} `json:"mergeCommit"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+}
+
+// PullRequest converts the result to the REST representation consumed by
+// the changelog and version packages.
+func (g graphQLPullRequest) PullRequest() *github.PullRequest {
+	updatedAt := g.UpdatedAt
+	pr := &github.PullRequest{
+		Number:    github.Int(g.Number),
+		Title:     github.String(g.Title),
+		Body:      github.String(g.Body),
+		HTMLURL:   github.String(g.URL),
+		UpdatedAt: &updatedAt,
+		MergedAt:  g.MergedAt,
+		Merged:    github.Bool(g.MergedAt != nil),
+		Base: &github.PullRequestBranch{
+			Ref: github.String(g.BaseRefName),
+		},
+	}
+
+	// GraphQL distinguishes merged from closed pull requests, REST does not.
+	if g.State == "OPEN" {
+		pr.State = github.String("open")
+	} else {
+		pr.State = github.String("closed")
+	}
+	if g.Author != nil {
+		pr.User = &github.User{
+			Login: github.String(g.Author.Login),
+		}
+	}
+	if g.MergeCommit != nil {
+		pr.MergeCommitSHA = github.String(g.MergeCommit.OID)
+	}
+	for _, l := range g.Labels.Nodes {
+		pr.Labels = append(pr.Labels, &github.Label{
+			Name: github.String(l.Name),
+		})
+	}
+
+	return pr
+}
+
+// pullRequestsQuery returns a GraphQL query fetching the pull requests ids.
+// The pull request with number N is aliased "prN".
+func pullRequestsQuery(ids []int) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "query($owner: String!, $repo: String!) {")
+	fmt.Fprintln(&b, "  repository(owner: $owner, name: $repo) {")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "    pr%d: pullRequest(number: %d) { ...pr }\n", id, id)
+	}
+	fmt.Fprintln(&b, "  }")
+	fmt.Fprintln(&b, "}")
+	b.WriteString(pullRequestFragment)
+	return b.String()
+}
+
+// fetchPullRequestsGraphQL returns the pull requests ids, in the same order,
+// fetching up to graphQLBatchSize pull requests with a single query.
+func (r Releaser) fetchPullRequestsGraphQL(ctx context.Context, ids []int) ([]*github.PullRequest, error) {
+	var ret []*github.PullRequest
+
+	for start := 0; start < len(ids); start += graphQLBatchSize {
+		end := start + graphQLBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+
+		var res struct {
+			Repository map[string]*graphQLPullRequest `json:"repository"`
+		}
+		vars := map[string]any{
+			"owner": r.owner,
+			"repo":  r.repo,
+		}
+		if err := r.client.GraphQL.Query(ctx, pullRequestsQuery(batch), vars, &res); err != nil {
+			return nil, fmt.Errorf("GraphQL.Query(%q, %q, <%d pull requests>): %w", r.owner, r.repo, len(batch), err)
+		}
+
+		for _, id := range batch {
+			g := res.Repository[fmt.Sprintf("pr%d", id)]
+			if g == nil {
+				return nil, fmt.Errorf("GraphQL.Query(%q, %q): pull request #%d not found", r.owner, r.repo, id)
+			}
+			ret = append(ret, g.PullRequest())
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,52 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// checkLabels returns an error if the policy references labels that do not
+// exist in the repository. Missing labels of the built-in default policy are
+// only logged, since repositories need not use all of them.
+func (r Releaser) checkLabels(ctx context.Context) error {
+	exists := make(map[string]bool)
+
+	opt := github.ListOptions{
+		PerPage: 100,
+	}
+	for {
+		labels, resp, err := r.client.Issues.ListLabels(ctx, r.owner, r.repo, &opt)
+		if err != nil {
+			return fmt.Errorf("Issues.ListLabels(%q, %q): %w", r.owner, r.repo, err)
+		}
+
+		for _, l := range labels {
+			exists[l.GetName()] = true
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	var missing []string
+	for _, name := range r.labels {
+		if !exists[name] {
+			missing = append(missing, fmt.Sprintf("%q", name))
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	if r.defaultPolicy {
+		log.Printf("Warning: the default policy references labels that do not exist in %s/%s: %s", r.owner, r.repo, strings.Join(missing, ", "))
+		return nil
+	}
+	return fmt.Errorf("the policy references labels that do not exist in %s/%s: %s", r.owner, r.repo, strings.Join(missing, ", "))
+}
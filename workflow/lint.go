@@ -0,0 +1,119 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/collectd/releaser/changelog"
+	"github.com/collectd/releaser/version"
+	"github.com/google/go-github/github"
+)
+
+// reminderMarker identifies the comments posted by remindChangeLog, so that
+// pull requests are reminded only once.
+const reminderMarker = "<!-- releaser: missing ChangeLog entry -->"
+
+const reminderText = reminderMarker + `
+This pull request requires a version bump, but its description has no ChangeLog entry. Please add a line like
+
+    ChangeLog: Foo plugin: Describe the change.
+
+to the description, or "ChangeLog: none" if the change should not be listed in the ChangeLog.`
+
+// MissingChangeLog returns true if pr requires a version bump, e.g. because it
+// is labeled "Feature" or "Fix", but has no ChangeLog entry and does not opt
+// out with "ChangeLog: none".
+func (r Releaser) MissingChangeLog(pr *github.PullRequest) bool {
+	bump, _ := r.versionPolicy.Classify(pr)
+	return bump > version.BumpNone && changelog.Missing(pr)
+}
+
+// lintChangeLog handles the pull requests of p that are missing a ChangeLog
+// entry. The pull requests in p.Remind are reminded with a comment, and an
+// error is returned in strict mode.
+func (r Releaser) lintChangeLog(ctx context.Context, p *Plan) error {
+	for _, number := range p.Remind {
+		if err := r.remindChangeLog(ctx, number); err != nil {
+			return err
+		}
+	}
+
+	if missing := p.missingChangeLog(); len(missing) != 0 && r.strict {
+		return fmt.Errorf("pull requests without ChangeLog entry: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// reportChangeLog logs the pull requests of p that are missing a ChangeLog
+// entry if that will make applying p fail in strict mode. Unlike
+// lintChangeLog, it has no side effects.
+func (r Releaser) reportChangeLog(p *Plan) {
+	if missing := p.missingChangeLog(); len(missing) != 0 && r.strict {
+		log.Printf("Warning: applying the plan will fail in strict mode; pull requests without ChangeLog entry: %s", strings.Join(missing, ", "))
+	}
+}
+
+// missingChangeLog returns the pull requests of p that are missing a
+// ChangeLog entry, e.g. "#123".
+func (p *Plan) missingChangeLog() []string {
+	var ret []string
+	for _, pr := range p.PullRequests {
+		if pr.MissingChangeLog {
+			ret = append(ret, fmt.Sprintf("#%d", pr.Number))
+		}
+	}
+	return ret
+}
+
+// remindChangeLog comments on pull request number that its ChangeLog entry is
+// missing, unless it has been reminded before.
+func (r Releaser) remindChangeLog(ctx context.Context, number int) error {
+	done, err := r.reminded(ctx, number)
+	if err != nil || done {
+		return err
+	}
+
+	if r.dryRun {
+		log.Printf("Would remind #%d of its missing ChangeLog entry", number)
+		return nil
+	}
+
+	comment := &github.IssueComment{
+		Body: github.String(reminderText),
+	}
+	if _, _, err := r.client.Issues.CreateComment(ctx, r.owner, r.repo, number, comment); err != nil {
+		return fmt.Errorf("Issues.CreateComment(%q, %q, %d): %w", r.owner, r.repo, number, err)
+	}
+	log.Printf("Reminded #%d of its missing ChangeLog entry", number)
+	return nil
+}
+
+// reminded returns true if pull request number has been reminded of its
+// missing ChangeLog entry before.
+func (r Releaser) reminded(ctx context.Context, number int) (bool, error) {
+	opt := github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	for {
+		comments, resp, err := r.client.Issues.ListComments(ctx, r.owner, r.repo, number, &opt)
+		if err != nil {
+			return false, fmt.Errorf("Issues.ListComments(%q, %q, %d): %w", r.owner, r.repo, number, err)
+		}
+
+		for _, c := range comments {
+			if strings.Contains(c.GetBody(), reminderMarker) {
+				return true, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return false, nil
+}
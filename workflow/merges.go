@@ -0,0 +1,358 @@
+package workflow
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// prFinder finds the pull requests merged between two refs.
+type prFinder interface {
+	// PRsBetween returns the numbers of the pull requests merged into head
+	// since base.
+	PRsBetween(ctx context.Context, base, head string) ([]int, error)
+}
+
+func newPRFinder(opts Options, client *Client) prFinder {
+	api := apiPRFinder{
+		client: client,
+		owner:  opts.Owner,
+		repo:   opts.Repo,
+		branch: opts.Branch,
+	}
+
+	discovery := opts.Discovery
+	if discovery == "" && opts.GitDir != "" {
+		discovery = "git"
+	}
+
+	if discovery == "git" {
+		return gitPRFinder{
+			gitDir: opts.GitDir,
+			branch: opts.Branch,
+			lookup: api.mergedPRs,
+		}
+	}
+	return api
+}
+
+// commit is a commit on the first-parent history of a branch.
+type commit struct {
+	sha     string
+	subject string
+	// parents holds the SHAs of the parent commits.
+	parents []string
+}
+
+var (
+	// mergeRE matches the subject of merge commits created by the "Create a
+	// merge commit" merge method.
+	mergeRE = regexp.MustCompile(`^Merge pull request #(\d+) from `)
+	// squashRE matches the subject of commits created by the "Squash and
+	// merge" merge method.
+	squashRE = regexp.MustCompile(`\(#(\d+)\)$`)
+)
+
+// subjectPR returns the number of the pull request referenced by a merge
+// commit or squash commit subject.
+func subjectPR(subject string) (int, bool) {
+	for _, re := range []*regexp.Regexp{mergeRE, squashRE} {
+		m := re.FindStringSubmatch(strings.TrimSpace(subject))
+		if m == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// lookupFunc returns the merged pull requests containing the commit sha. If
+// branch is not empty, only pull requests merged into branch are returned.
+type lookupFunc func(ctx context.Context, sha, branch string) ([]int, error)
+
+// sideFunc returns the first-parent history, newest first, of the commits a
+// merge commit brought in from another branch, i.e. of the commits reachable
+// from its second parent but not from the previous release.
+type sideFunc func(ctx context.Context, merge commit) ([]commit, error)
+
+// resolvePRs returns the pull requests that landed commits on branch, in
+// order and without duplicates. Merge commits and squash commits are
+// recognized by their subject. For all other commits, e.g. those landed by
+// "Rebase and merge", lookup is called if not nil. Merge commits without a
+// pull request, e.g. "Merge branch 'collectd-5.12' into collectd-6.0", are
+// resolved by the pull requests merged on the other branch, which are found
+// in the commits returned by side.
+func resolvePRs(ctx context.Context, commits []commit, branch string, lookup lookupFunc, side sideFunc) ([]int, error) {
+	var (
+		ret     []int
+		seen    = make(map[int]bool)
+		visited = make(map[string]bool)
+	)
+	add := func(ns ...int) {
+		for _, n := range ns {
+			if !seen[n] {
+				seen[n] = true
+				ret = append(ret, n)
+			}
+		}
+	}
+
+	var walk func(commits []commit, branch string) error
+	walk = func(commits []commit, branch string) error {
+		for _, c := range commits {
+			if visited[c.sha] {
+				continue
+			}
+			visited[c.sha] = true
+
+			if n, ok := subjectPR(c.subject); ok {
+				add(n)
+				continue
+			}
+			if lookup != nil {
+				ns, err := lookup(ctx, c.sha, branch)
+				if err != nil {
+					return err
+				}
+				if len(ns) != 0 {
+					add(ns...)
+					continue
+				}
+			}
+			if len(c.parents) < 2 || side == nil {
+				continue
+			}
+
+			sideCommits, err := side(ctx, c)
+			if err != nil {
+				return err
+			}
+			// The pull requests on the other branch were merged into
+			// that branch, not into ours.
+			if err := walk(sideCommits, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(commits, branch); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// gitPRFinder reads the history of a local clone.
+type gitPRFinder struct {
+	gitDir string
+	branch string
+	// lookup returns the pull requests a commit was merged by. It is used
+	// for commits without a pull request reference in their subject.
+	lookup lookupFunc
+}
+
+func (f gitPRFinder) PRsBetween(ctx context.Context, base, head string) ([]int, error) {
+	commits, err := f.commits(ctx, base, head)
+	if err != nil {
+		return nil, err
+	}
+	side := func(ctx context.Context, merge commit) ([]commit, error) {
+		return f.commits(ctx, base, merge.parents[1])
+	}
+	return resolvePRs(ctx, commits, f.branch, f.lookup, side)
+}
+
+// commits returns the first-parent history between base and head, newest
+// first.
+func (f gitPRFinder) commits(ctx context.Context, base, head string) ([]commit, error) {
+	log.Printf("git log --first-parent --pretty='%%H %%P %%s' %s..%s", base, head)
+	cmd := exec.CommandContext(ctx, "git", "log", "--first-parent", "--pretty=%H%x00%P%x00%s", base+".."+head)
+	cmd.Env = append(os.Environ(), "GIT_DIR="+f.gitDir)
+
+	reader, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("cmd.StdoutPipe(): %w", err)
+	}
+	errReader, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("cmd.StderrPipe(): %w", err)
+	}
+	go func() {
+		s := bufio.NewScanner(errReader)
+		for s.Scan() {
+			log.Printf("ERROR: git log: %s", s.Text())
+		}
+	}()
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cmd.Start(): %w", err)
+	}
+
+	var ret []commit
+	s := bufio.NewScanner(reader)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), "\x00", 3)
+		if len(fields) != 3 || fields[0] == "" {
+			continue
+		}
+		ret = append(ret, commit{
+			sha:     fields[0],
+			subject: fields[2],
+			parents: strings.Fields(fields[1]),
+		})
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("cmd.Wait(): %w", err)
+	}
+
+	return ret, nil
+}
+
+// apiPRFinder finds pull requests using only the GitHub API: it lists the
+// commits between two refs and looks up the pull requests associated with
+// each commit.
+type apiPRFinder struct {
+	client              *Client
+	owner, repo, branch string
+}
+
+func (f apiPRFinder) PRsBetween(ctx context.Context, base, head string) ([]int, error) {
+	all, err := f.commits(ctx, base, head)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Found %d commit(s) between %q and %q", len(all), base, head)
+
+	var commits []commit
+	if len(all) != 0 {
+		sha, err := tip(all)
+		if err != nil {
+			return nil, fmt.Errorf("commits between %q and %q: %w", base, head, err)
+		}
+		commits = firstParents(all, sha)
+	}
+	side := func(_ context.Context, merge commit) ([]commit, error) {
+		return firstParents(all, merge.parents[1]), nil
+	}
+	return resolvePRs(ctx, commits, f.branch, f.mergedPRs, side)
+}
+
+// commits returns the commits between base and head, oldest first.
+func (f apiPRFinder) commits(ctx context.Context, base, head string) ([]github.RepositoryCommit, error) {
+	var (
+		all []github.RepositoryCommit
+		opt = github.ListOptions{
+			PerPage: 100,
+		}
+	)
+	for {
+		cmp, resp, err := f.client.Repositories.CompareCommits(ctx, f.owner, f.repo, base, head, &opt)
+		if err != nil {
+			return nil, fmt.Errorf("Repositories.CompareCommits(%q, %q, %q, %q): %w", f.owner, f.repo, base, head, err)
+		}
+
+		all = append(all, cmp.Commits...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return all, nil
+}
+
+// tip returns the SHA of the only commit in commits that is not a parent of
+// another commit in commits, i.e. the head of the compared range. The order of
+// commits is irrelevant.
+func tip(commits []github.RepositoryCommit) (string, error) {
+	parents := make(map[string]bool)
+	for _, c := range commits {
+		for _, p := range c.Parents {
+			parents[p.GetSHA()] = true
+		}
+	}
+
+	var ret []string
+	for _, c := range commits {
+		if !parents[c.GetSHA()] {
+			ret = append(ret, c.GetSHA())
+		}
+	}
+	if len(ret) != 1 {
+		return "", fmt.Errorf("found %d head commit(s) %v, want 1", len(ret), ret)
+	}
+	return ret[0], nil
+}
+
+// firstParents returns the commits on the first-parent history of the commit
+// sha, newest first, as far as it is included in commits. Commits that were
+// merged by a merge commit are skipped.
+func firstParents(commits []github.RepositoryCommit, sha string) []commit {
+	bySHA := make(map[string]*github.RepositoryCommit)
+	for i := range commits {
+		bySHA[commits[i].GetSHA()] = &commits[i]
+	}
+
+	var ret []commit
+	for c := bySHA[sha]; c != nil; {
+		subject, _, _ := strings.Cut(c.GetCommit().GetMessage(), "\n")
+		e := commit{
+			sha:     c.GetSHA(),
+			subject: subject,
+		}
+		for _, p := range c.Parents {
+			e.parents = append(e.parents, p.GetSHA())
+		}
+		ret = append(ret, e)
+
+		if len(c.Parents) == 0 {
+			break
+		}
+		c = bySHA[c.Parents[0].GetSHA()]
+	}
+
+	return ret
+}
+
+// mergedPRs returns the merged pull requests containing sha. If branch is not
+// empty, only pull requests merged into branch are returned.
+func (f apiPRFinder) mergedPRs(ctx context.Context, sha, branch string) ([]int, error) {
+	var (
+		ret []int
+		opt = github.ListOptions{
+			PerPage: 100,
+		}
+	)
+	for {
+		prs, resp, err := f.client.PullRequests.ListPullRequestsWithCommit(ctx, f.owner, f.repo, sha, &opt)
+		if err != nil {
+			return nil, fmt.Errorf("PullRequests.ListPullRequestsWithCommit(%q, %q, %q): %w", f.owner, f.repo, sha, err)
+		}
+
+		for _, pr := range prs {
+			if pr.MergedAt == nil || (branch != "" && pr.GetBase().GetRef() != branch) {
+				continue
+			}
+			ret = append(ret, pr.GetNumber())
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return ret, nil
+}
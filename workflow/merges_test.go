@@ -0,0 +1,201 @@
+package workflow
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/github"
+)
+
+func TestSubjectPR(t *testing.T) {
+	cases := []struct {
+		subject string
+		want    int
+		wantOK  bool
+	}{
+		{"Merge pull request #4123 from octo/feature", 4123, true},
+		{"Write Prometheus plugin: Fix label escaping. (#4124)", 4124, true},
+		{"Fix label escaping (#4125) ", 4125, true},
+		{"Merge branch 'collectd-5.12' into collectd-6.0", 0, false},
+		{"Fix #4126 in the cpu plugin", 0, false},
+		{"Update ChangeLog for version 6.1.0.", 0, false},
+	}
+
+	for _, tc := range cases {
+		got, ok := subjectPR(tc.subject)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("subjectPR(%q) = (%d, %v), want (%d, %v)", tc.subject, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestResolvePRs(t *testing.T) {
+	commits := []commit{
+		{sha: "a", subject: "Merge pull request #3 from octo/merge"},
+		{sha: "b", subject: "Squashed change (#2)"},
+		{sha: "c", subject: "Rebased change, part 2"},
+		{sha: "d", subject: "Rebased change, part 1"},
+		{sha: "e", subject: "Revert of a squashed change (#2)"},
+		{sha: "f", subject: "Pushed directly"},
+		{sha: "g", subject: "Merge branch 'collectd-5.12' into collectd-6.0", parents: []string{"f", "y"}},
+	}
+	// Commits on collectd-5.12, merged into the branch by "g".
+	side := map[string][]commit{
+		"g": {
+			{sha: "y", subject: "Merge pull request #5 from octo/old"},
+			{sha: "x", subject: "Rebased change on the old branch"},
+			{sha: "c", subject: "Rebased change, part 2"},
+		},
+	}
+	associated := map[string][]int{
+		"c": {1},
+		"d": {1},
+		"x": {4},
+	}
+
+	var looked []string
+	lookup := func(_ context.Context, sha, branch string) ([]int, error) {
+		looked = append(looked, sha+"@"+branch)
+		return associated[sha], nil
+	}
+	sideFn := func(_ context.Context, merge commit) ([]commit, error) {
+		return side[merge.sha], nil
+	}
+
+	got, err := resolvePRs(context.Background(), commits, "main", lookup, sideFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{3, 2, 1, 5, 4}, got); diff != "" {
+		t.Errorf("resolvePRs() differs (-want/+got):\n%s", diff)
+	}
+	// Commits on the other branch are looked up regardless of the base
+	// branch, and every commit is looked up only once.
+	wantLooked := []string{"c@main", "d@main", "f@main", "g@main", "x@"}
+	if diff := cmp.Diff(wantLooked, looked); diff != "" {
+		t.Errorf("looked up commits differ (-want/+got):\n%s", diff)
+	}
+}
+
+func TestFirstParents(t *testing.T) {
+	newCommit := func(sha, message string, parents ...string) github.RepositoryCommit {
+		c := github.RepositoryCommit{
+			SHA: github.String(sha),
+			Commit: &github.Commit{
+				Message: github.String(message),
+			},
+		}
+		for _, p := range parents {
+			c.Parents = append(c.Parents, github.Commit{SHA: github.String(p)})
+		}
+		return c
+	}
+
+	// base <- squash <- merge(squash, topic) <- rebased
+	//            \- topic -/
+	commits := []github.RepositoryCommit{
+		newCommit("squash", "Squashed change (#1)\n\nDetails.", "base"),
+		newCommit("topic", "Change on a topic branch", "base"),
+		newCommit("merge", "Merge pull request #2 from octo/topic\n\nTopic.", "squash", "topic"),
+		newCommit("rebased", "Rebased change", "merge"),
+	}
+
+	want := []commit{
+		{sha: "rebased", subject: "Rebased change", parents: []string{"merge"}},
+		{sha: "merge", subject: "Merge pull request #2 from octo/topic", parents: []string{"squash", "topic"}},
+		{sha: "squash", subject: "Squashed change (#1)", parents: []string{"base"}},
+	}
+	if diff := cmp.Diff(want, firstParents(commits, "rebased"), cmp.AllowUnexported(commit{})); diff != "" {
+		t.Errorf("firstParents() differs (-want/+got):\n%s", diff)
+	}
+
+	wantSide := []commit{
+		{sha: "topic", subject: "Change on a topic branch", parents: []string{"base"}},
+	}
+	if diff := cmp.Diff(wantSide, firstParents(commits, "topic"), cmp.AllowUnexported(commit{})); diff != "" {
+		t.Errorf("firstParents() differs (-want/+got):\n%s", diff)
+	}
+
+	// The head is found regardless of the order of the commits.
+	shuffled := []github.RepositoryCommit{commits[2], commits[3], commits[0], commits[1]}
+	if got, err := tip(shuffled); err != nil || got != "rebased" {
+		t.Errorf("tip() = %q, %v, want %q", got, err, "rebased")
+	}
+	if got, err := tip(commits[:2]); err == nil {
+		t.Errorf("tip() of two unrelated commits = %q, want error", got)
+	}
+}
+
+func TestGitPRFinderBranchMerge(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(subject string) {
+		t.Helper()
+		git("commit", "--allow-empty", "-m", subject)
+	}
+
+	git("init", "-q", "-b", "collectd-6.0")
+	commit("Initial commit")
+	git("tag", "base")
+	git("branch", "collectd-5.12")
+
+	commit("New feature (#1)")
+
+	// A fix lands on the old release branch and is merged forward.
+	git("checkout", "-q", "collectd-5.12")
+	commit("Old fix (#2)")
+	commit("Rebased old fix")
+	git("checkout", "-q", "collectd-6.0")
+	git("merge", "-q", "--no-ff", "-m", "Merge branch 'collectd-5.12' into collectd-6.0", "collectd-5.12")
+
+	commit("Another feature (#3)")
+
+	rebased := git("rev-parse", "collectd-5.12")
+	var looked []string
+	f := gitPRFinder{
+		gitDir: filepath.Join(dir, ".git"),
+		branch: "collectd-6.0",
+		lookup: func(_ context.Context, sha, branch string) ([]int, error) {
+			looked = append(looked, branch)
+			if sha == rebased {
+				return []int{4}, nil
+			}
+			return nil, nil
+		},
+	}
+
+	got, err := f.PRsBetween(context.Background(), "base", "collectd-6.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{3, 4, 2, 1}, got); diff != "" {
+		t.Errorf("PRsBetween() differs (-want/+got):\n%s", diff)
+	}
+	// The merge commit is looked up on the release branch, the rebased
+	// commit on any branch.
+	if diff := cmp.Diff([]string{"collectd-6.0", ""}, looked); diff != "" {
+		t.Errorf("lookup branches differ (-want/+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,66 @@
+package workflow
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/collectd/releaser/changelog"
+	"github.com/collectd/releaser/version"
+	"github.com/google/go-github/github"
+)
+
+// Pending are the changes on the branch since the last release.
+type Pending struct {
+	Release      *github.RepositoryRelease
+	Version      version.Version
+	PullRequests []*github.PullRequest
+}
+
+// Pending returns the last release and the pull requests merged since. It
+// makes no changes.
+func (r Releaser) Pending(ctx context.Context) (*Pending, error) {
+	prevRelease, err := r.lastRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prevVersion, err := r.format.New(prevRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	prs, err := r.pullRequestsSince(ctx, prevRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pending{
+		Release:      prevRelease,
+		Version:      prevVersion,
+		PullRequests: prs,
+	}, nil
+}
+
+// NextVersion returns the version following the last release and the decision
+// it is based on.
+func (r Releaser) NextVersion(p *Pending) (version.Version, version.Decision, error) {
+	d := r.versionPolicy.Decide(p.PullRequests)
+	next, err := p.Version.Next(p.PullRequests, r.versionPolicy)
+	return next, d, err
+}
+
+// Classify returns the bump required by pr and a human readable reason.
+func (r Releaser) Classify(pr *github.PullRequest) (version.Bump, string) {
+	return r.versionPolicy.Classify(pr)
+}
+
+// ChangeLog returns the ChangeLog of version v, consisting of prs. Problems
+// with the entries, e.g. unknown plugin names, are logged.
+func (r Releaser) ChangeLog(date time.Time, v version.Version, prs []*github.PullRequest) changelog.Data {
+	cl := r.changeLogPolicy.New(date, v, prs)
+	for _, w := range cl.Warnings() {
+		log.Printf("Warning: %s", w)
+	}
+	return cl
+}
@@ -0,0 +1,306 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/collectd/releaser/diff"
+	"github.com/collectd/releaser/version"
+	"github.com/google/go-github/github"
+)
+
+// Plan describes all changes a release will make. It is computed by
+// Releaser.Plan and can be saved, reviewed, and executed later by
+// Releaser.Apply.
+type Plan struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	// Head is the SHA of the branch head the plan was computed for.
+	Head string `json:"head"`
+
+	PreviousVersion string `json:"previous_version"`
+	Version         string `json:"version"`
+	// Reason explains the version bump.
+	Reason       string        `json:"reason"`
+	PullRequests []PlannedPR   `json:"pull_requests"`
+	ChangeLog    ChangeLogDiff `json:"changelog"`
+	// Remind lists the pull requests that will be reminded of their missing
+	// ChangeLog entry with a comment.
+	Remind []int `json:"remind,omitempty"`
+	// StateFile is the file the progress of the release is persisted to.
+	// Empty if progress is not persisted.
+	StateFile string `json:"state_file,omitempty"`
+
+	State State `json:"state"`
+}
+
+// PlannedPR is a pull request included in a release.
+type PlannedPR struct {
+	Number int          `json:"number"`
+	Title  string       `json:"title"`
+	Bump   version.Bump `json:"bump"`
+	Reason string       `json:"reason,omitempty"`
+	// MissingChangeLog is true if the pull request requires a version bump
+	// but has no ChangeLog entry.
+	MissingChangeLog bool `json:"missing_changelog,omitempty"`
+}
+
+// ChangeLogDiff is the change to the ChangeLog file.
+type ChangeLogDiff struct {
+	CommitMessage string `json:"commit_message"`
+	Diff          string `json:"diff"`
+}
+
+// Plan computes the plan for the next release without making any changes.
+// It returns nil if there is nothing to release.
+func (r Releaser) Plan(ctx context.Context) (*Plan, error) {
+	if err := r.checkLabels(ctx); err != nil {
+		return nil, err
+	}
+
+	prevRelease, err := r.lastRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Previous release was %q at tag %q", prevRelease.GetName(), prevRelease.GetTagName())
+
+	st, err := r.loadState(prevRelease.GetTagName())
+	if err != nil {
+		return nil, err
+	}
+	if st != nil {
+		return nil, fmt.Errorf("the release of %s is in progress (see %s); run the release again to resume it", st.Tag, r.statePath(st.Tag))
+	}
+
+	p, err := r.plan(ctx, prevRelease)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	r.reportChangeLog(p)
+
+	return p, nil
+}
+
+func (r Releaser) plan(ctx context.Context, prevRelease *github.RepositoryRelease) (*Plan, error) {
+	head, err := r.GitCheckout(ctx, r.branch)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkStatus(ctx, head.GetCommit().GetSHA()); err != nil {
+		return nil, err
+	}
+	log.Printf("All checks on %q (%s) have succeeded", r.branch, head.GetCommit().GetSHA())
+
+	prs, err := r.pullRequestsSince(ctx, prevRelease)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Found %d pull request(s)", len(prs))
+
+	if len(prs) == 0 {
+		return nil, nil
+	}
+
+	prevVersion, err := r.format.New(prevRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	nextVersion, err := prevVersion.Next(prs, r.versionPolicy)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("The next version is %s", nextVersion)
+
+	changeLog := r.ChangeLog(time.Now(), nextVersion, prs)
+
+	prevContent, err := head.CatFile(ctx, "ChangeLog")
+	if err != nil {
+		return nil, err
+	}
+	var content bytes.Buffer
+	fmt.Fprintln(&content, changeLog.FileFormat())
+	content.Write(prevContent)
+
+	p := &Plan{
+		Owner:           r.owner,
+		Repo:            r.repo,
+		Branch:          r.branch,
+		Head:            head.GetCommit().GetSHA(),
+		PreviousVersion: prevVersion.String(),
+		Version:         nextVersion.String(),
+		Reason:          r.versionPolicy.Decide(prs).String(),
+		ChangeLog: ChangeLogDiff{
+			CommitMessage: changeLogCommitMessage(nextVersion),
+			Diff:          diff.Unified("a/ChangeLog", "b/ChangeLog", prevContent, content.Bytes()),
+		},
+		State: *newState(prevRelease.GetTagName(), head.GetCommit().GetSHA(), nextVersion, changeLog, prs),
+	}
+	for _, pr := range prs {
+		bump, reason := r.versionPolicy.Classify(pr)
+		missing := r.MissingChangeLog(pr)
+		if missing {
+			log.Printf("Warning: #%d %q has no ChangeLog entry", pr.GetNumber(), pr.GetTitle())
+		}
+		p.PullRequests = append(p.PullRequests, PlannedPR{
+			Number:           pr.GetNumber(),
+			Title:            pr.GetTitle(),
+			Bump:             bump,
+			Reason:           reason,
+			MissingChangeLog: missing,
+		})
+
+		if !missing || !r.remind {
+			continue
+		}
+		reminded, err := r.reminded(ctx, pr.GetNumber())
+		if err != nil {
+			return nil, err
+		}
+		if !reminded {
+			p.Remind = append(p.Remind, pr.GetNumber())
+		}
+	}
+	if r.stateDir != "" {
+		p.StateFile = r.statePath(p.State.Tag)
+	}
+
+	return p, nil
+}
+
+// Apply executes a plan computed by Plan. It refuses to run if the branch
+// head has moved since the plan was computed, other than by a previous,
+// interrupted Apply of the same plan. The pull requests in p.Remind are
+// reminded of their missing ChangeLog entry, and pull requests without
+// ChangeLog entry are rejected in strict mode, before anything is changed.
+func (r Releaser) Apply(ctx context.Context, p *Plan) error {
+	if p.Owner != r.owner || p.Repo != r.repo || p.Branch != r.branch {
+		return fmt.Errorf("the plan is for %s/%s branch %q, not %s/%s branch %q", p.Owner, p.Repo, p.Branch, r.owner, r.repo, r.branch)
+	}
+
+	st := p.State
+	st.Done = make(map[Step]string)
+
+	prev, err := r.loadState(st.Base)
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		if prev.Tag != st.Tag {
+			return fmt.Errorf("the release of %s is in progress (see %s), not %s", prev.Tag, r.statePath(prev.Tag), st.Tag)
+		}
+		log.Printf("Resuming release of %s from %s", prev.Tag, r.statePath(prev.Tag))
+		st = *prev
+	}
+
+	wantHead := p.Head
+	if _, ok := st.Done[StepChangeLog]; ok {
+		wantHead = st.Target
+	}
+
+	head, err := r.GitCheckout(ctx, r.branch)
+	if err != nil {
+		return err
+	}
+	if got := head.GetCommit().GetSHA(); got != wantHead {
+		return fmt.Errorf("branch %q has moved from %s to %s since the plan was computed", r.branch, wantHead, got)
+	}
+
+	if len(st.Done) == 0 {
+		if err := r.lintChangeLog(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	return r.execute(ctx, &st)
+}
+
+// ReadPlan reads a plan written by Plan.Write.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Write saves the plan as JSON to path.
+func (p *Plan) Write(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// String returns a human readable description of the plan.
+func (p *Plan) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Release plan for %s/%s, branch %q at %s\n\n", p.Owner, p.Repo, p.Branch, p.Head)
+
+	kind := "release"
+	if p.isPreRelease() {
+		kind = "pre-release"
+	}
+	fmt.Fprintf(&b, "Version: %s -> %s (%s)\n", p.PreviousVersion, p.Version, kind)
+	fmt.Fprintf(&b, "Reason:  %s\n\n", p.Reason)
+
+	fmt.Fprintf(&b, "Pull requests (%d):\n", len(p.PullRequests))
+	for _, pr := range p.PullRequests {
+		fmt.Fprintf(&b, "  #%-5d %-5s %s", pr.Number, pr.Bump, pr.Title)
+		if pr.Reason != "" {
+			fmt.Fprintf(&b, " [%s]", pr.Reason)
+		}
+		if pr.MissingChangeLog {
+			fmt.Fprint(&b, " (no ChangeLog entry)")
+		}
+		fmt.Fprintln(&b)
+	}
+	fmt.Fprintln(&b)
+
+	n := 0
+	step := func(format string, args ...any) {
+		n++
+		fmt.Fprintf(&b, "%d. ", n)
+		fmt.Fprintf(&b, format, args...)
+		fmt.Fprintln(&b)
+	}
+
+	fmt.Fprintln(&b, "Changes:")
+	if len(p.Remind) != 0 {
+		var prs []string
+		for _, n := range p.Remind {
+			prs = append(prs, fmt.Sprintf("#%d", n))
+		}
+		step("Comment on %s to ask for the missing ChangeLog entry.", strings.Join(prs, ", "))
+	}
+	step("Commit %q on top of %s to branch %q:", p.ChangeLog.CommitMessage, p.Head, p.Branch)
+	fmt.Fprintln(&b, p.ChangeLog.Diff)
+	step("Create tag %q on the ChangeLog commit.", p.State.Tag)
+	step("Create GitHub %s %q with the following notes:", kind, p.Version)
+	fmt.Fprintln(&b, p.State.Notes)
+	if p.StateFile != "" {
+		step("Record the progress of the release in %q.", p.StateFile)
+	}
+
+	return b.String()
+}
+
+func (p *Plan) isPreRelease() bool {
+	v, err := version.Parse(p.Version)
+	return err == nil && v.IsPreRelease()
+}
@@ -0,0 +1,136 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/collectd/releaser/changelog"
+	"github.com/collectd/releaser/version"
+)
+
+// Promote turns the release candidate tagged tag into a final release. If tag
+// is empty, the release with the highest version is promoted.
+//
+// The final tag is created on the release candidate's commit, so that the
+// final release contains exactly the tested code. The ChangeLog sections of
+// the release candidates are replaced with a single section for the final
+// version in a separate commit on the branch. The release notes contain all
+// ChangeLog entries since the last final release.
+//
+// Promote can be run again if it has been interrupted: a ChangeLog that
+// already has a section for the final version is left alone.
+func (r Releaser) Promote(ctx context.Context, tag string) error {
+	rc, rcVersion, err := r.findRelease(ctx, func(v version.Version) bool {
+		return tag == "" || v.Tag() == tag
+	})
+	if err != nil {
+		return fmt.Errorf("release %q: %w", tag, err)
+	}
+
+	final, err := rcVersion.Promote()
+	if err != nil {
+		return err
+	}
+	log.Printf("Promoting %q to %s", rc.GetTagName(), final)
+
+	existing, _, err := r.findRelease(ctx, func(v version.Version) bool {
+		return v.Compare(final) == 0 && !v.IsPreRelease()
+	})
+	switch {
+	case err == nil:
+		return fmt.Errorf("version %s has already been released: %s", final, existing.GetHTMLURL())
+	case !errors.Is(err, errNoRelease):
+		return err
+	}
+
+	prevFinal, _, err := r.findRelease(ctx, func(v version.Version) bool {
+		return !v.IsPreRelease() && v.Less(final)
+	})
+	if err != nil {
+		return fmt.Errorf("previous final release: %w", err)
+	}
+	log.Printf("Previous final release was %q at tag %q", prevFinal.GetName(), prevFinal.GetTagName())
+
+	sha, err := r.tagCommit(ctx, rc.GetTagName())
+	if err != nil {
+		return err
+	}
+
+	prs, err := r.pullRequestsBetween(ctx, prevFinal.GetTagName(), rc.GetTagName())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	changeLog := r.ChangeLog(now, final, prs)
+	log.Printf("ChangeLog:\n%v", changeLog)
+
+	if err := r.promoteChangeLog(ctx, now, final); err != nil {
+		return err
+	}
+
+	_, err = r.createGitHubRelease(ctx, final, sha, changeLog.Markdown())
+	return err
+}
+
+// tagCommit returns the SHA of the commit tag points to, dereferencing
+// annotated tags.
+func (r Releaser) tagCommit(ctx context.Context, tag string) (string, error) {
+	ref, _, err := r.client.Git.GetRef(ctx, r.owner, r.repo, "tags/"+tag)
+	if err != nil {
+		return "", fmt.Errorf("Git.GetRef(%q, %q, %q): %w", r.owner, r.repo, "tags/"+tag, err)
+	}
+
+	obj := ref.GetObject()
+	if obj.GetType() == "tag" {
+		t, _, err := r.client.Git.GetTag(ctx, r.owner, r.repo, obj.GetSHA())
+		if err != nil {
+			return "", fmt.Errorf("Git.GetTag(%q, %q, %q): %w", r.owner, r.repo, obj.GetSHA(), err)
+		}
+		obj = t.GetObject()
+	}
+
+	if obj.GetType() != "commit" {
+		return "", fmt.Errorf("tag %q points to a %s, want commit", tag, obj.GetType())
+	}
+	return obj.GetSHA(), nil
+}
+
+// promoteChangeLog commits the ChangeLog on the branch with the sections of
+// the pre-releases of final replaced by a single section for final, unless
+// the ChangeLog already has a section for final.
+func (r Releaser) promoteChangeLog(ctx context.Context, date time.Time, final version.Version) error {
+	b, err := r.GitCheckout(ctx, r.branch)
+	if err != nil {
+		return err
+	}
+
+	prevContent, err := b.CatFile(ctx, "ChangeLog")
+	if err != nil {
+		return err
+	}
+
+	for _, cl := range changelog.Parse(prevContent) {
+		if cl.Version().Compare(final) == 0 {
+			log.Printf("The ChangeLog already contains a section for %s", final)
+			return nil
+		}
+	}
+
+	content, err := changelog.Promote(prevContent, date, final)
+	if err != nil {
+		return err
+	}
+
+	if r.dryRun {
+		log.Println("File ChangeLog header:")
+		log.Println(changelog.Header(date, final))
+		return nil
+	}
+
+	b.GitAdd("ChangeLog", content)
+	return b.GitCommit(ctx, changeLogCommitMessage(final))
+}
@@ -0,0 +1,367 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// rateLimitAttempts is the number of times a rate limited request is sent.
+const rateLimitAttempts = 3
+
+// secondaryRateLimitDelay is the time to wait after the first rejection
+// because of a secondary rate limit if GitHub does not say how long to wait.
+// It doubles with every further attempt.
+const secondaryRateLimitDelay = time.Minute
+
+// RateLimitError is returned when a request is still rate limited after
+// waiting for the rate limit to reset.
+type RateLimitError struct {
+	Endpoint string
+	Reset    time.Time
+}
+
+func (err *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: rate limit exceeded until %s", err.Endpoint, err.Reset.Format(time.RFC3339))
+}
+
+// budget is the state of one rate limit, e.g. "core" or "graphql".
+type budget struct {
+	limit, remaining int
+	reset            time.Time
+}
+
+// rateLimitTransport counts requests per endpoint and honors the GitHub rate
+// limit headers: requests are delayed while the rate limit is exhausted, and
+// requests rejected because of a primary or secondary rate limit are sent
+// again after waiting as long as requested.
+type rateLimitTransport struct {
+	base http.RoundTripper
+	// sleep and now are replaced by tests and when replaying.
+	sleep func(ctx context.Context, d time.Duration) error
+	now   func() time.Time
+
+	mu      sync.Mutex
+	budgets map[string]budget
+	calls   map[string]int
+	total   int
+}
+
+func newRateLimitTransport(base http.RoundTripper) *rateLimitTransport {
+	return &rateLimitTransport{
+		base:    base,
+		sleep:   sleepContext,
+		now:     time.Now,
+		budgets: make(map[string]budget),
+		calls:   make(map[string]int),
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ep := endpoint(req)
+	resource := "core"
+	if strings.HasSuffix(req.URL.Path, "/graphql") {
+		resource = "graphql"
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := t.waitForReset(req.Context(), resource); err != nil {
+			return nil, err
+		}
+
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		t.count(ep)
+		res, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		wait, limited := t.update(res, attempt)
+		if !limited {
+			return res, nil
+		}
+		res.Body.Close()
+
+		reset := t.now().Add(wait)
+		if attempt == rateLimitAttempts {
+			return nil, &RateLimitError{
+				Endpoint: ep,
+				Reset:    reset,
+			}
+		}
+
+		log.Printf("%s: rate limited, waiting %v until %s", ep, wait.Round(time.Second), reset.Format(time.TimeOnly))
+		if err := t.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForReset waits until the rate limit of resource resets if it has been
+// exhausted.
+func (t *rateLimitTransport) waitForReset(ctx context.Context, resource string) error {
+	t.mu.Lock()
+	b, ok := t.budgets[resource]
+	t.mu.Unlock()
+
+	if !ok || b.remaining > 0 {
+		return nil
+	}
+	wait := b.reset.Sub(t.now())
+	if wait <= 0 {
+		return nil
+	}
+
+	log.Printf("The %s rate limit is exhausted, waiting %v until %s", resource, wait.Round(time.Second), b.reset.Format(time.TimeOnly))
+	return t.sleep(ctx, wait)
+}
+
+func (t *rateLimitTransport) count(ep string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.calls[ep]++
+	t.total++
+}
+
+// update records the rate limit reported by res, the response to the attempt-th
+// request. It returns true and the time to wait if the request has been
+// rejected because of a rate limit.
+func (t *rateLimitTransport) update(res *http.Response, attempt int) (time.Duration, bool) {
+	h := res.Header
+	remaining, remainingErr := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+
+	var reset time.Time
+	if epoch, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		reset = time.Unix(epoch, 0)
+	}
+
+	if remainingErr == nil {
+		limit, _ := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+		resource := h.Get("X-RateLimit-Resource")
+		if resource == "" {
+			resource = "core"
+		}
+
+		t.mu.Lock()
+		t.budgets[resource] = budget{
+			limit:     limit,
+			remaining: remaining,
+			reset:     reset,
+		}
+		total := t.total
+		t.mu.Unlock()
+
+		if total%100 == 0 || remaining < limit/10 {
+			log.Printf("GitHub API %s rate limit: %d of %d requests remaining, resets at %s", resource, remaining, limit, reset.Format(time.TimeOnly))
+		}
+	}
+
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	// Secondary rate limits are reported with a Retry-After header.
+	if s := h.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if remainingErr == nil && remaining == 0 {
+		// One extra second accounts for clock skew.
+		return reset.Sub(t.now()) + time.Second, true
+	}
+	// Otherwise, secondary rate limits are only recognizable by the error
+	// message.
+	if secondaryRateLimited(res) {
+		return secondaryRateLimitDelay << (attempt - 1), true
+	}
+
+	return 0, false
+}
+
+// secondaryRateLimited returns true if the body of the error response res
+// reports a secondary rate limit. The body is restored for the caller.
+func secondaryRateLimited(res *http.Response) bool {
+	if res.Body == nil {
+		return false
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(bytes.ToLower(body), []byte("secondary rate limit"))
+}
+
+// endpoint returns the method and the path of req with parameters replaced by
+// placeholders, e.g. "GET /repos/:owner/:repo/pulls/:number".
+func endpoint(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	// GitHub Enterprise serves the REST API below "/api/v3".
+	if len(segments) >= 2 && segments[0] == "api" && segments[1] == "v3" {
+		segments = segments[2:]
+	}
+
+	var ret []string
+	for i := 0; i < len(segments); i++ {
+		s := segments[i]
+		switch {
+		case s == "repos" && i+2 < len(segments):
+			ret = append(ret, s, ":owner", ":repo")
+			i += 2
+		case knownSegments[s]:
+			ret = append(ret, s)
+		case len(ret) != 0 && strings.HasPrefix(ret[len(ret)-1], ":"):
+			// Paths, e.g. of "contents", and refs may contain slashes.
+		default:
+			ret = append(ret, paramName(ret))
+		}
+	}
+
+	return req.Method + " /" + strings.Join(ret, "/")
+}
+
+// knownSegments are the literal path segments of the endpoints in use.
+var knownSegments = map[string]bool{
+	"api": true, "app": true, "access_tokens": true, "branches": true,
+	"check-runs": true, "comments": true, "commits": true, "compare": true, "contents": true,
+	"git": true, "graphql": true, "heads": true, "installation": true, "installations": true,
+	"issues": true, "labels": true, "pulls": true, "rate_limit": true,
+	"refs": true, "releases": true, "status": true, "tags": true,
+	"trees": true,
+}
+
+// paramName returns the placeholder for a parameter following the segments
+// in path.
+func paramName(path []string) string {
+	if len(path) == 0 {
+		return ":param"
+	}
+	switch path[len(path)-1] {
+	case "pulls", "issues":
+		return ":number"
+	case "commits", "trees":
+		return ":sha"
+	case "branches":
+		return ":branch"
+	case "contents":
+		return ":path"
+	case "compare":
+		return ":basehead"
+	case "tags", "heads", "refs":
+		return ":ref"
+	default:
+		return ":id"
+	}
+}
+
+// APIUsage is the number of GitHub API requests made per endpoint and the
+// remaining rate limit.
+type APIUsage struct {
+	// Calls maps endpoints, e.g. "GET /repos/:owner/:repo/pulls/:number",
+	// to the number of requests made.
+	Calls map[string]int `json:"calls"`
+	// Remaining maps rate limit resources, e.g. "core", to the number of
+	// requests remaining.
+	Remaining map[string]int `json:"remaining,omitempty"`
+}
+
+// APIUsage returns the GitHub API requests made so far. It is empty if the
+// Releaser was created with Options.Client.
+func (r Releaser) APIUsage() APIUsage {
+	if r.client.rateLimit == nil {
+		return APIUsage{}
+	}
+	return r.client.rateLimit.usage()
+}
+
+// usage returns the requests made so far.
+func (t *rateLimitTransport) usage() APIUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := APIUsage{
+		Calls:     make(map[string]int),
+		Remaining: make(map[string]int),
+	}
+	for ep, n := range t.calls {
+		u.Calls[ep] = n
+	}
+	for resource, b := range t.budgets {
+		u.Remaining[resource] = b.remaining
+	}
+	return u
+}
+
+// String returns a table of the endpoints, sorted by the number of requests.
+func (u APIUsage) String() string {
+	var (
+		eps   []string
+		total int
+	)
+	for ep, n := range u.Calls {
+		eps = append(eps, ep)
+		total += n
+	}
+	sort.Slice(eps, func(i, j int) bool {
+		if u.Calls[eps[i]] != u.Calls[eps[j]] {
+			return u.Calls[eps[i]] > u.Calls[eps[j]]
+		}
+		return eps[i] < eps[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "GitHub API requests: %d\n", total)
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, ep := range eps {
+		fmt.Fprintf(w, "%d\t  %s\n", u.Calls[ep], ep)
+	}
+	w.Flush()
+
+	var resources []string
+	for r := range u.Remaining {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+	for _, r := range resources {
+		fmt.Fprintf(&b, "Remaining %s rate limit: %d\n", r, u.Remaining[r])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,206 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func response(code int, header map[string]string) *http.Response {
+	res := &http.Response{
+		StatusCode: code,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader("{}")),
+	}
+	for k, v := range header {
+		res.Header.Set(k, v)
+	}
+	return res
+}
+
+// newTestTransport returns a rateLimitTransport with a fake clock, which is
+// advanced by sleeping.
+func newTestTransport(base roundTripFunc) (*rateLimitTransport, *[]time.Duration) {
+	now := time.Unix(1700000000, 0)
+	var slept []time.Duration
+
+	t := newRateLimitTransport(base)
+	t.now = func() time.Time { return now }
+	t.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		now = now.Add(d)
+		return nil
+	}
+	return t, &slept
+}
+
+func TestRateLimitSecondary(t *testing.T) {
+	var bodies []string
+	calls := 0
+	rl, slept := newTestTransport(func(req *http.Request) (*http.Response, error) {
+		calls++
+		b, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(b))
+		if calls == 1 {
+			return response(http.StatusForbidden, map[string]string{"Retry-After": "60"}), nil
+		}
+		return response(http.StatusOK, nil), nil
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/repos/collectd/collectd/git/trees", strings.NewReader(`{"tree":[]}`))
+	res, err := rl.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if diff := cmp.Diff([]time.Duration{time.Minute}, *slept); diff != "" {
+		t.Errorf("sleeps differ (-want/+got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{`{"tree":[]}`, `{"tree":[]}`}, bodies); diff != "" {
+		t.Errorf("request bodies differ (-want/+got):\n%s", diff)
+	}
+
+	want := map[string]int{"POST /repos/:owner/:repo/git/trees": 2}
+	if diff := cmp.Diff(want, rl.usage().Calls); diff != "" {
+		t.Errorf("calls differ (-want/+got):\n%s", diff)
+	}
+}
+
+func TestRateLimitSecondaryWithoutRetryAfter(t *testing.T) {
+	calls := 0
+	rl, slept := newTestTransport(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls < 3 {
+			res := response(http.StatusForbidden, map[string]string{
+				"X-RateLimit-Limit":     "5000",
+				"X-RateLimit-Remaining": "4000",
+			})
+			res.Body = io.NopCloser(strings.NewReader(`{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`))
+			return res, nil
+		}
+		return response(http.StatusOK, nil), nil
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.github.com/repos/collectd/collectd/issues/1/comments", nil)
+	res, err := rl.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if diff := cmp.Diff([]time.Duration{time.Minute, 2 * time.Minute}, *slept); diff != "" {
+		t.Errorf("sleeps differ (-want/+got):\n%s", diff)
+	}
+}
+
+func TestRateLimitForbidden(t *testing.T) {
+	rl, slept := newTestTransport(func(req *http.Request) (*http.Response, error) {
+		res := response(http.StatusForbidden, map[string]string{
+			"X-RateLimit-Limit":     "5000",
+			"X-RateLimit-Remaining": "4000",
+		})
+		res.Body = io.NopCloser(strings.NewReader(`{"message":"Resource not accessible by integration"}`))
+		return res, nil
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/collectd/collectd/releases", nil)
+	res, err := rl.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("StatusCode = %d, want %d", res.StatusCode, http.StatusForbidden)
+	}
+	if body, _ := io.ReadAll(res.Body); !strings.Contains(string(body), "not accessible") {
+		t.Errorf("response body = %q, want the error message", body)
+	}
+	if len(*slept) != 0 {
+		t.Errorf("slept %v, want no retries of a permission error", *slept)
+	}
+}
+
+func TestRateLimitPrimary(t *testing.T) {
+	var rl *rateLimitTransport
+	rl, slept := newTestTransport(func(req *http.Request) (*http.Response, error) {
+		return response(http.StatusOK, map[string]string{
+			"X-RateLimit-Limit":     "5000",
+			"X-RateLimit-Remaining": "0",
+			"X-RateLimit-Reset":     strconv.FormatInt(rl.now().Add(30*time.Second).Unix(), 10),
+		}), nil
+	})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/collectd/collectd/pulls/42", nil)
+		if _, err := rl.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second request waits for the reset announced by the first.
+	if diff := cmp.Diff([]time.Duration{30 * time.Second}, *slept); diff != "" {
+		t.Errorf("sleeps differ (-want/+got):\n%s", diff)
+	}
+	if got, want := rl.usage().Remaining["core"], 0; got != want {
+		t.Errorf("remaining = %d, want %d", got, want)
+	}
+}
+
+func TestRateLimitGiveUp(t *testing.T) {
+	rl, slept := newTestTransport(func(req *http.Request) (*http.Response, error) {
+		return response(http.StatusTooManyRequests, map[string]string{"Retry-After": "1"}), nil
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/collectd/collectd/releases", nil)
+	_, err := rl.RoundTrip(req)
+
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("RoundTrip() = %v, want *RateLimitError", err)
+	}
+	if got, want := len(*slept), rateLimitAttempts-1; got != want {
+		t.Errorf("slept %d times, want %d", got, want)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	cases := []struct {
+		method, url string
+		want        string
+	}{
+		{"GET", "https://api.github.com/repos/collectd/collectd/pulls/4123", "GET /repos/:owner/:repo/pulls/:number"},
+		{"GET", "https://api.github.com/repos/collectd/collectd/contents/src/daemon/plugin.c?ref=main", "GET /repos/:owner/:repo/contents/:path"},
+		{"GET", "https://api.github.com/repos/collectd/collectd/git/refs/tags/collectd-6.0.0", "GET /repos/:owner/:repo/git/refs/tags/:ref"},
+		{"GET", "https://api.github.com/repos/collectd/collectd/compare/collectd-6.0.0...main", "GET /repos/:owner/:repo/compare/:basehead"},
+		{"GET", "https://api.github.com/repos/collectd/collectd/commits/0123abcd/check-runs", "GET /repos/:owner/:repo/commits/:sha/check-runs"},
+		{"PATCH", "https://api.github.com/repos/collectd/collectd/git/refs/heads/collectd-6.0", "PATCH /repos/:owner/:repo/git/refs/heads/:ref"},
+		{"POST", "https://api.github.com/repos/collectd/collectd/issues/4123/comments", "POST /repos/:owner/:repo/issues/:number/comments"},
+		{"POST", "https://github.example.com/api/graphql", "POST /api/graphql"},
+		{"GET", "https://github.example.com/api/v3/repos/collectd/collectd/releases", "GET /repos/:owner/:repo/releases"},
+	}
+
+	for _, tc := range cases {
+		req, err := http.NewRequest(tc.method, tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := endpoint(req); got != tc.want {
+			t.Errorf("endpoint(%s %s) = %q, want %q", tc.method, tc.url, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/collectd/releaser/changelog"
+	"github.com/collectd/releaser/version"
+	"github.com/google/go-github/github"
+)
+
+// Step is a single side effect of the release workflow.
+type Step string
+
+const (
+	// StepChangeLog commits the new section of the ChangeLog file.
+	StepChangeLog Step = "changelog"
+	// StepRelease creates the tag and the GitHub release.
+	StepRelease Step = "release"
+)
+
+// steps lists all steps of a release in the order they are executed.
+var steps = []Step{StepChangeLog, StepRelease}
+
+// State is the progress of a release. It is persisted as JSON in the state
+// directory, in a file named after the target tag, after each completed step.
+// A release is resumed from its state instead of being recomputed, so that no
+// step is repeated.
+type State struct {
+	// Tag is the tag of the release being created.
+	Tag string `json:"tag"`
+	// Base is the tag of the previous release.
+	Base string `json:"base"`
+	// Target is the commit the tag is created on. It is updated when the
+	// ChangeLog commit is created.
+	Target string    `json:"target"`
+	Date   time.Time `json:"date"`
+	// PullRequests lists the numbers of the pull requests in the release.
+	PullRequests []int `json:"pull_requests"`
+	// ChangeLog is the new section of the ChangeLog file.
+	ChangeLog string `json:"changelog"`
+	// Notes is the body of the GitHub release.
+	Notes string `json:"notes"`
+	// Done maps completed steps to their result, e.g. a commit SHA.
+	Done map[Step]string `json:"done,omitempty"`
+}
+
+func newState(base, target string, v version.Version, cl changelog.Data, prs []*github.PullRequest) *State {
+	st := &State{
+		Tag:       v.Tag(),
+		Base:      base,
+		Target:    target,
+		Date:      cl.Date(),
+		ChangeLog: cl.FileFormat(),
+		Notes:     cl.Markdown(),
+		Done:      make(map[Step]string),
+	}
+	for _, pr := range prs {
+		st.PullRequests = append(st.PullRequests, pr.GetNumber())
+	}
+	return st
+}
+
+// Complete returns true if all steps have been executed.
+func (st *State) Complete() bool {
+	for _, s := range steps {
+		if _, ok := st.Done[s]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Releaser) statePath(tag string) string {
+	return filepath.Join(r.stateDir, tag+".json")
+}
+
+// loadState returns the incomplete release based on the release tagged base,
+// or nil if there is none.
+func (r Releaser) loadState(base string) (*State, error) {
+	if r.stateDir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(r.stateDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var st State
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if st.Base == base && !st.Complete() {
+			if st.Done == nil {
+				st.Done = make(map[Step]string)
+			}
+			return &st, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r Releaser) saveState(st *State) error {
+	if r.stateDir == "" || r.dryRun {
+		return nil
+	}
+
+	if err := os.MkdirAll(r.stateDir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that the state is never truncated.
+	path := r.statePath(st.Tag)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// execute runs all steps that have not been completed yet, persisting the
+// state after each step.
+func (r Releaser) execute(ctx context.Context, st *State) error {
+	v, err := r.format.Parse(st.Tag)
+	if err != nil {
+		return err
+	}
+
+	if err := r.saveState(st); err != nil {
+		return err
+	}
+
+	for _, s := range steps {
+		if res, ok := st.Done[s]; ok {
+			log.Printf("Step %q has already been completed: %s", s, res)
+			continue
+		}
+
+		var res string
+		switch s {
+		case StepChangeLog:
+			res, err = r.stepChangeLog(ctx, st, v)
+		case StepRelease:
+			res, err = r.stepRelease(ctx, st, v)
+		}
+		if err != nil {
+			return fmt.Errorf("step %q: %w", s, err)
+		}
+
+		if r.dryRun {
+			continue
+		}
+
+		st.Done[s] = res
+		if err := r.saveState(st); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stepChangeLog commits the new ChangeLog section unless the ChangeLog file
+// already contains it, and returns the commit SHA. It refuses to commit if the
+// branch head has moved away from st.Target, e.g. while an interrupted
+// release was waiting to be resumed, since the release would then contain
+// changes that are not in its ChangeLog.
+func (r Releaser) stepChangeLog(ctx context.Context, st *State, v version.Version) (string, error) {
+	b, err := r.GitCheckout(ctx, r.branch)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := b.CatFile(ctx, "ChangeLog")
+	if err != nil {
+		return "", err
+	}
+
+	if header := changelog.Header(st.Date, v); bytes.HasPrefix(content, []byte(header+"\n")) {
+		log.Printf("The ChangeLog already contains %q", header)
+		st.Target = b.GetCommit().GetSHA()
+		return st.Target, nil
+	}
+
+	if head := b.GetCommit().GetSHA(); head != st.Target {
+		return "", fmt.Errorf("branch %q has moved from %s to %s since the release was planned", r.branch, st.Target, head)
+	}
+
+	sha, err := r.updateChangeLog(ctx, b, v, st.ChangeLog)
+	if err != nil {
+		return "", err
+	}
+	if sha != "" {
+		st.Target = sha
+	}
+	return sha, nil
+}
+
+// stepRelease creates the GitHub release unless it exists already, and
+// returns its URL.
+func (r Releaser) stepRelease(ctx context.Context, st *State, v version.Version) (string, error) {
+	rel, _, err := r.client.Repositories.GetReleaseByTag(ctx, r.owner, r.repo, st.Tag)
+	if err == nil {
+		log.Printf("Release %q exists already: %s", st.Tag, rel.GetHTMLURL())
+		return rel.GetHTMLURL(), nil
+	}
+	var respErr *github.ErrorResponse
+	if !errors.As(err, &respErr) || respErr.Response.StatusCode != http.StatusNotFound {
+		return "", fmt.Errorf("Repositories.GetReleaseByTag(%q, %q, %q): %w", r.owner, r.repo, st.Tag, err)
+	}
+
+	return r.createGitHubRelease(ctx, v, st.Target, st.Notes)
+}
@@ -0,0 +1,264 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// checkState is the consolidated state of a single commit status context or
+// check run.
+type checkState int
+
+const (
+	statePending checkState = iota
+	stateFailure
+	stateSuccess
+)
+
+func (s checkState) String() string {
+	switch s {
+	case statePending:
+		return "pending"
+	case stateFailure:
+		return "failure"
+	default:
+		return "success"
+	}
+}
+
+// StatusError is returned when the commit to be released has failed or
+// pending checks.
+type StatusError struct {
+	SHA     string
+	Failed  []string
+	Pending []string
+}
+
+func (err *StatusError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "commit %s is not green", err.SHA)
+	if len(err.Failed) != 0 {
+		fmt.Fprintf(&b, "; failed: %s", strings.Join(err.Failed, ", "))
+	}
+	if len(err.Pending) != 0 {
+		fmt.Fprintf(&b, "; pending: %s", strings.Join(err.Pending, ", "))
+	}
+	return b.String()
+}
+
+// Check is the state of a single required status context or check run.
+type Check struct {
+	Name string `json:"name"`
+	// State is one of "success", "failure", "pending" and "missing".
+	State string `json:"state"`
+}
+
+// Status is the state of the required checks on the branch head.
+type Status struct {
+	Branch string  `json:"branch"`
+	SHA    string  `json:"sha"`
+	Checks []Check `json:"checks"`
+}
+
+// Green returns true if all required checks have succeeded.
+func (st *Status) Green() bool {
+	return st.Err() == nil
+}
+
+// Err returns a *StatusError if any required check has not succeeded.
+func (st *Status) Err() error {
+	statusErr := &StatusError{
+		SHA: st.SHA,
+	}
+	for _, c := range st.Checks {
+		switch c.State {
+		case "missing":
+			statusErr.Pending = append(statusErr.Pending, c.Name+" (missing)")
+		case "pending":
+			statusErr.Pending = append(statusErr.Pending, c.Name)
+		case "failure":
+			statusErr.Failed = append(statusErr.Failed, c.Name)
+		}
+	}
+
+	if len(statusErr.Failed) != 0 || len(statusErr.Pending) != 0 {
+		return statusErr
+	}
+	return nil
+}
+
+// Status returns the state of the required checks on the branch head.
+func (r Releaser) Status(ctx context.Context) (*Status, error) {
+	head, err := r.GitCheckout(ctx, r.branch)
+	if err != nil {
+		return nil, err
+	}
+	return r.status(ctx, head.GetCommit().GetSHA())
+}
+
+// noChecks is the name of the pending check reported if no checks are
+// required explicitly and none have been reported.
+const noChecks = "no checks reported"
+
+// status returns the state of the required checks on sha. The combined commit
+// status and the check runs are consulted. If no checks are required
+// explicitly, all reported checks are required, and sha is pending until at
+// least one check has been reported.
+func (r Releaser) status(ctx context.Context, sha string) (*Status, error) {
+	states, err := r.commitStates(ctx, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &Status{
+		Branch: r.branch,
+		SHA:    sha,
+	}
+
+	required := r.requiredChecks
+	if len(required) == 0 {
+		if len(states) == 0 {
+			st.Checks = []Check{{
+				Name:  noChecks,
+				State: statePending.String(),
+			}}
+			return st, nil
+		}
+		for name := range states {
+			required = append(required, name)
+		}
+		sort.Strings(required)
+	}
+
+	for _, name := range required {
+		c := Check{
+			Name:  name,
+			State: "missing",
+		}
+		if state, ok := states[name]; ok {
+			c.State = state.state.String()
+		}
+		st.Checks = append(st.Checks, c)
+	}
+
+	return st, nil
+}
+
+// checkStatus returns an error if any of the required checks on sha has not
+// succeeded.
+func (r Releaser) checkStatus(ctx context.Context, sha string) error {
+	st, err := r.status(ctx, sha)
+	if err != nil {
+		return err
+	}
+	return st.Err()
+}
+
+// reportedState is the state of a status context or check run, and the time
+// it was last reported.
+type reportedState struct {
+	state checkState
+	time  time.Time
+}
+
+// commitStates returns the state of all status contexts and check runs
+// reported for sha, keyed by context and check name respectively. If a name
+// has been reported more than once, e.g. because a check has been re-run, the
+// latest report wins.
+func (r Releaser) commitStates(ctx context.Context, sha string) (map[string]reportedState, error) {
+	ret := make(map[string]reportedState)
+	report := func(name string, s reportedState) {
+		if prev, ok := ret[name]; ok && prev.time.After(s.time) {
+			return
+		}
+		ret[name] = s
+	}
+
+	opt := github.ListOptions{
+		PerPage: 100,
+	}
+	for {
+		combined, resp, err := r.client.Repositories.GetCombinedStatus(ctx, r.owner, r.repo, sha, &opt)
+		if err != nil {
+			return nil, fmt.Errorf("Repositories.GetCombinedStatus(%q, %q, %q): %w", r.owner, r.repo, sha, err)
+		}
+
+		for _, s := range combined.Statuses {
+			report(s.GetContext(), reportedState{
+				state: statusState(s.GetState()),
+				time:  latest(s.GetCreatedAt(), s.GetUpdatedAt()),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	checkOpt := github.ListCheckRunsOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	for {
+		res, resp, err := r.client.Checks.ListCheckRunsForRef(ctx, r.owner, r.repo, sha, &checkOpt)
+		if err != nil {
+			return nil, fmt.Errorf("Checks.ListCheckRunsForRef(%q, %q, %q): %w", r.owner, r.repo, sha, err)
+		}
+
+		for _, run := range res.CheckRuns {
+			report(run.GetName(), reportedState{
+				state: checkRunState(run),
+				time:  latest(run.GetStartedAt().Time, run.GetCompletedAt().Time),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		checkOpt.Page = resp.NextPage
+	}
+
+	return ret, nil
+}
+
+// latest returns the latest of times.
+func latest(times ...time.Time) time.Time {
+	var ret time.Time
+	for _, t := range times {
+		if t.After(ret) {
+			ret = t
+		}
+	}
+	return ret
+}
+
+func statusState(state string) checkState {
+	switch state {
+	case "success":
+		return stateSuccess
+	case "pending":
+		return statePending
+	default:
+		return stateFailure
+	}
+}
+
+func checkRunState(run *github.CheckRun) checkState {
+	if run.GetStatus() != "completed" {
+		return statePending
+	}
+
+	switch run.GetConclusion() {
+	case "success", "neutral", "skipped":
+		return stateSuccess
+	default:
+		return stateFailure
+	}
+}
@@ -1,32 +1,42 @@
 package workflow
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
-	"os"
-	"os/exec"
-	"strconv"
-	"strings"
-	"time"
+	"regexp"
 
 	"github.com/collectd/releaser/changelog"
+	"github.com/collectd/releaser/policy"
 	"github.com/collectd/releaser/version"
 	"github.com/google/go-github/github"
-	"github.com/octo/retry"
-	"golang.org/x/oauth2"
 )
 
 type Releaser struct {
 	owner, repo string
 	branch      string
-	client      *github.Client
-	gitDir      string
+	client      *Client
+	prFinder    prFinder
 	dryRun      bool
+	stateDir    string
+	strict      bool
+	remind      bool
+	concurrency int
+	fetcher     string
+	cache       prCache
+
+	requiredChecks  []string
+	format          version.Format
+	releaseName     *regexp.Regexp
+	versionPolicy   version.Policy
+	changeLogPolicy changelog.Policy
+	labels          []string
+	// defaultPolicy is true if the built-in policy is used because no
+	// policy has been configured.
+	defaultPolicy bool
 }
 
 type Options struct {
@@ -36,65 +46,181 @@ type Options struct {
 	AccessToken string
 	GitDir      string
 	DryRun      bool
-}
 
-func New(_ context.Context, opts Options) *Releaser {
-	return &Releaser{
-		owner:  opts.Owner,
-		repo:   opts.Repo,
-		branch: opts.Branch,
-		client: newClient(opts.AccessToken),
-		gitDir: opts.GitDir,
-		dryRun: opts.DryRun,
-	}
+	// AppID, AppInstallationID and AppPrivateKeyFile authenticate as a
+	// GitHub App installation instead of with AccessToken. Installation
+	// tokens are refreshed automatically.
+	AppID             int64
+	AppInstallationID int64
+	AppPrivateKeyFile string
+
+	// BaseURL is the GitHub API base URL, e.g.
+	// "https://github.example.com/api/v3/" for GitHub Enterprise. Defaults to
+	// "https://api.github.com/".
+	BaseURL string
+	// UploadURL is the GitHub upload URL. Defaults to the "/api/uploads/"
+	// path next to BaseURL for GitHub Enterprise.
+	UploadURL string
+
+	// Client, if not nil, is used to access GitHub instead of a client
+	// created from the options above.
+	Client *Client
+	// RecordDir, if not empty, is the directory all GitHub API requests and
+	// responses are recorded to, with credentials redacted.
+	RecordDir string
+	// ReplayDir, if not empty, is a directory written by RecordDir. The
+	// recorded responses are served instead of accessing GitHub, and
+	// requests that have not been recorded fail.
+	ReplayDir string
+
+	// Concurrency is the number of pull requests fetched at the same time.
+	// Defaults to DefaultConcurrency.
+	Concurrency int
+	// Fetcher selects how pull requests are fetched: "rest" makes one
+	// call per pull request, "graphql" fetches up to 100 pull requests
+	// with a single query. Defaults to "rest".
+	Fetcher string
+	// CacheDir, if not empty, is the directory pull requests are cached in,
+	// so that they are only fetched again after they have been updated.
+	CacheDir string
+
+	// Discovery selects how merged pull requests are found: "git" uses the
+	// local clone at GitDir, "api" uses only the GitHub API. Defaults to
+	// "git" if GitDir is set and "api" otherwise.
+	Discovery string
+
+	// StrictChangeLog aborts Run if pull requests requiring a version bump
+	// have no ChangeLog entry and do not opt out with "ChangeLog: none".
+	StrictChangeLog bool
+	// RemindChangeLog comments on pull requests missing a ChangeLog entry
+	// when a release is created. Each pull request is reminded once.
+	RemindChangeLog bool
+
+	// StateDir is the directory in which the progress of releases is
+	// persisted, so that interrupted releases can be resumed. If empty,
+	// progress is not persisted.
+	StateDir string
+
+	// RequiredChecks lists the commit status contexts and check run names
+	// that must have succeeded on the branch head before a release is made.
+	// If empty, all reported checks must have succeeded, and at least one
+	// check must have been reported.
+	RequiredChecks []string
+
+	// TagPrefix is the part of tag names preceding the version number. If
+	// empty, the prefix of version.DefaultFormat, "collectd-", is used.
+	TagPrefix string
+	// MajorVersions restricts the major versions considered. If empty, all
+	// major versions are considered.
+	MajorVersions []int
+	// ReleaseNameFilter, if not nil, restricts the releases considered to
+	// those with a matching name.
+	ReleaseNameFilter *regexp.Regexp
+
+	// Policy maps labels to version bumps and ChangeLog categories. If
+	// Policy.Labels is nil, policy.Default is used.
+	Policy policy.Policy
+	// AllowMajor confirms that a major release may be created.
+	AllowMajor bool
+	// PreRelease is the suffix of release candidates, e.g. "-rc". If empty,
+	// final releases are created directly.
+	PreRelease string
 }
 
-func (r Releaser) Run(ctx context.Context) error {
-	// TODO: check if HEAD commit is "green"
-
-	prevRelease, err := r.lastRelease(ctx)
-	if err != nil {
-		return err
+// New returns a Releaser configured by opts.
+func New(_ context.Context, opts Options) (*Releaser, error) {
+	p := opts.Policy
+	if p.Labels == nil {
+		p = policy.Default
+	}
+	tagPrefix := opts.TagPrefix
+	if tagPrefix == "" {
+		tagPrefix = version.DefaultFormat.TagPrefix
 	}
-	log.Printf("Previous release was %q at tag %q", prevRelease.GetName(), prevRelease.GetTagName())
 
-	prs, err := r.pullRequestsSince(ctx, prevRelease)
-	if err != nil {
-		return err
+	client := opts.Client
+	if client == nil {
+		var err error
+		client, err = newClient(opts)
+		if err != nil {
+			return nil, err
+		}
 	}
-	log.Printf("Found %d pull request(s)", len(prs))
 
-	if len(prs) == 0 {
-		return nil
+	return &Releaser{
+		owner:    opts.Owner,
+		repo:     opts.Repo,
+		branch:   opts.Branch,
+		client:   client,
+		prFinder: newPRFinder(opts, client),
+		dryRun:   opts.DryRun,
+
+		stateDir:       opts.StateDir,
+		strict:         opts.StrictChangeLog,
+		remind:         opts.RemindChangeLog,
+		concurrency:    opts.Concurrency,
+		fetcher:        opts.Fetcher,
+		cache:          newPRCache(opts.CacheDir, opts.Owner, opts.Repo),
+		requiredChecks: opts.RequiredChecks,
+		format: version.Format{
+			TagPrefix: tagPrefix,
+			Majors:    opts.MajorVersions,
+		},
+		releaseName: opts.ReleaseNameFilter,
+		versionPolicy: version.Policy{
+			Classifier: p.Classifier,
+			Labels:     p.Bumps(),
+			AllowMajor: opts.AllowMajor,
+			PreRelease: opts.PreRelease,
+		},
+		changeLogPolicy: p.ChangeLog(),
+		labels:          p.LabelNames(),
+		defaultPolicy:   opts.Policy.Labels == nil,
+	}, nil
+}
+
+// Run creates the next release, or resumes an interrupted release. It returns
+// the state of the release, or nil if there is nothing to release.
+func (r Releaser) Run(ctx context.Context) (*State, error) {
+	if err := r.checkLabels(ctx); err != nil {
+		return nil, err
 	}
 
-	prevVersion, err := version.New(prevRelease)
+	prevRelease, err := r.lastRelease(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	log.Printf("Previous release was %q at tag %q", prevRelease.GetName(), prevRelease.GetTagName())
 
-	nextVersion, err := prevVersion.Next(prs)
+	st, err := r.loadState(prevRelease.GetTagName())
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if st != nil {
+		log.Printf("Resuming release of %s from %s", st.Tag, r.statePath(st.Tag))
+		return st, r.execute(ctx, st)
 	}
-	log.Printf("The next version is %s", nextVersion)
-
-	changeLog := changelog.New(time.Now(), nextVersion, prs)
-	fmt.Printf("ChangeLog:\n%v", changeLog)
 
-	if err := r.updateChangeLog(ctx, nextVersion, changeLog); err != nil {
-		return err
+	plan, err := r.plan(ctx, prevRelease)
+	if err != nil || plan == nil {
+		return nil, err
 	}
+	log.Print(plan)
 
-	if err := r.createGitHubRelease(ctx, nextVersion, changeLog); err != nil {
-		return err
+	if err := r.lintChangeLog(ctx, plan); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &plan.State, r.execute(ctx, &plan.State)
 }
 
 func (r Releaser) pullRequestsSince(ctx context.Context, prevRelease *github.RepositoryRelease) ([]*github.PullRequest, error) {
-	ids, err := r.prIDsSince(ctx, prevRelease.GetTagName())
+	return r.pullRequestsBetween(ctx, prevRelease.GetTagName(), r.branch)
+}
+
+// pullRequestsBetween returns the pull requests merged into head since base.
+func (r Releaser) pullRequestsBetween(ctx context.Context, base, head string) ([]*github.PullRequest, error) {
+	ids, err := r.prFinder.PRsBetween(ctx, base, head)
 	if err != nil {
 		return nil, err
 	}
@@ -106,86 +232,60 @@ func (r Releaser) pullRequestsSince(ctx context.Context, prevRelease *github.Rep
 
 	log.Printf("Found %d pull request(s):\n", len(ids))
 
-	var ret []*github.PullRequest
-	for _, id := range ids {
-		pr, _, err := r.client.PullRequests.Get(ctx, r.owner, r.repo, id)
-		if err != nil {
-			return nil, fmt.Errorf("PullRequests.Get(%q, %q, %d): %w", r.owner, r.repo, id, err)
-		}
-		ret = append(ret, pr)
+	ret, err := r.fetchPullRequests(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, pr := range ret {
 		log.Printf("* #%d %q\n", pr.GetNumber(), pr.GetTitle())
 	}
 
 	return ret, nil
 }
 
-func (r Releaser) prIDsSince(ctx context.Context, ref string) ([]int, error) {
-	log.Printf("git log --merges --pretty=oneline --grep='Merge pull request' %s..%s", r.branch, ref)
-	cmd := exec.CommandContext(ctx, "git", "log", "--merges", "--pretty=oneline", "--grep=Merge pull request", ref+".."+r.branch)
-	cmd.Env = append(os.Environ(), "GIT_DIR="+r.gitDir)
+var errNoRelease = errors.New("no release found")
 
-	reader, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("cmd.StdoutPipe(): %w", err)
-	}
-	errReader, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("cmd.StderrPipe(): %w", err)
-	}
-	go func() {
-		s := bufio.NewScanner(errReader)
-		for s.Scan() {
-			fmt.Printf("ERROR: git log: %s\n", s.Text())
-		}
-	}()
-
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("cmd.Start(): %w", err)
-	}
-
-	var ret []int
-	s := bufio.NewScanner(reader)
-	for s.Scan() {
-		line := s.Text()
-		fields := strings.Split(line, " ")
-		if len(fields) < 5 {
-			continue
-		}
-		n, err := strconv.Atoi(strings.TrimPrefix(fields[4], "#"))
-		if err != nil || n <= 0 {
-			continue
-		}
-		ret = append(ret, n)
-	}
-
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("cmd.Wait(): %w", err)
-	}
-
-	return ret, nil
+// lastRelease returns the release with the highest version. Drafts and
+// releases not matching the configured name filter and tag format are
+// ignored.
+func (r Releaser) lastRelease(ctx context.Context) (*github.RepositoryRelease, error) {
+	rel, _, err := r.findRelease(ctx, func(version.Version) bool { return true })
+	return rel, err
 }
 
-func (r Releaser) lastRelease(ctx context.Context) (*github.RepositoryRelease, error) {
+// findRelease returns the release with the highest version for which match
+// returns true. Drafts and releases not matching the configured name filter
+// and tag format are ignored.
+func (r Releaser) findRelease(ctx context.Context, match func(version.Version) bool) (*github.RepositoryRelease, version.Version, error) {
 	var (
 		opt = github.ListOptions{
 			PerPage: 100,
 		}
-		ret *github.RepositoryRelease
+		ret        *github.RepositoryRelease
+		retVersion version.Version
 	)
 
 	for {
 		releases, resp, err := r.client.Repositories.ListReleases(ctx, r.owner, r.repo, &opt)
 		if err != nil {
-			return nil, fmt.Errorf("Repositories.ListReleases(%q, %q): %w", r.owner, r.repo, err)
+			return nil, version.Version{}, fmt.Errorf("Repositories.ListReleases(%q, %q): %w", r.owner, r.repo, err)
 		}
 
-		for _, r := range releases {
-			if !strings.HasPrefix(r.GetName(), "6") || r.GetDraft() {
+		for _, rel := range releases {
+			if rel.GetDraft() {
+				continue
+			}
+			if r.releaseName != nil && !r.releaseName.MatchString(rel.GetName()) {
+				continue
+			}
+			v, err := r.format.New(rel)
+			if err != nil || !match(v) {
 				continue
 			}
 
-			if ret == nil || ret.GetCreatedAt().Before(r.GetCreatedAt().Time) {
-				ret = r
+			if ret == nil || retVersion.Less(v) {
+				ret = rel
+				retVersion = v
 			}
 		}
 
@@ -196,72 +296,67 @@ func (r Releaser) lastRelease(ctx context.Context) (*github.RepositoryRelease, e
 	}
 
 	if ret == nil {
-		return nil, fmt.Errorf("no release found")
-	}
-
-	return ret, nil
-}
-
-func newClient(accessToken string) *github.Client {
-	t := &retry.Transport{
-		RoundTripper: &oauth2.Transport{
-			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken}),
-		},
+		return nil, version.Version{}, errNoRelease
 	}
 
-	return github.NewClient(&http.Client{
-		Transport: t,
-	})
+	return ret, retVersion, nil
 }
 
-func (r Releaser) updateChangeLog(ctx context.Context, version version.Version, changes changelog.Data) error {
-	b, err := r.GitCheckout(ctx, r.branch)
-	if err != nil {
-		return err
-	}
-
+// updateChangeLog prepends section to the ChangeLog file on b and returns the
+// SHA of the resulting commit.
+func (r Releaser) updateChangeLog(ctx context.Context, b *GitBranch, version version.Version, section string) (string, error) {
 	var buf bytes.Buffer
-	fmt.Fprintln(&buf, changes.FileFormat())
+	fmt.Fprintln(&buf, section)
 
 	prevContent, err := b.CatFile(ctx, "ChangeLog")
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if _, err := io.Copy(&buf, bytes.NewReader(prevContent)); err != nil {
-		return err
+		return "", err
 	}
 
 	if r.dryRun {
 		log.Println("File ChangeLog:")
-		log.Println(changes.FileFormat())
-		return nil
+		log.Println(section)
+		return "", nil
 	}
 
 	b.GitAdd("ChangeLog", buf.Bytes())
-	return b.GitCommit(ctx, fmt.Sprintf("Update ChangeLog for version %s.", version))
+	if err := b.GitCommit(ctx, changeLogCommitMessage(version)); err != nil {
+		return "", err
+	}
+	return b.GetCommit().GetSHA(), nil
+}
+
+func changeLogCommitMessage(v version.Version) string {
+	return fmt.Sprintf("Update ChangeLog for version %s.", v)
 }
 
-func (r Releaser) createGitHubRelease(ctx context.Context, version version.Version, changes changelog.Data) error {
+// createGitHubRelease creates the release for version and returns its URL.
+// The tag is created on target, a branch name or commit SHA, unless it exists
+// already.
+func (r Releaser) createGitHubRelease(ctx context.Context, version version.Version, target, body string) (string, error) {
 	rel := &github.RepositoryRelease{
 		TagName:         github.String(version.Tag()),
-		TargetCommitish: github.String(r.branch),
+		TargetCommitish: github.String(target),
 		Name:            github.String(version.String()),
-		Body:            github.String(changes.Markdown()),
-		Prerelease:      github.Bool(true),
+		Body:            github.String(body),
+		Prerelease:      github.Bool(version.IsPreRelease()),
 	}
 
 	if r.dryRun {
 		log.Println("GitHub Release:")
 		log.Printf("%v\n", rel)
-		return nil
+		return "", nil
 	}
 
 	rel, _, err := r.client.Repositories.CreateRelease(ctx, r.owner, r.repo, rel)
 	if err != nil {
-		return fmt.Errorf("Repositories.CreateRelease(%q, %q, %q): %w", r.owner, r.repo, version, err)
+		return "", fmt.Errorf("Repositories.CreateRelease(%q, %q, %q): %w", r.owner, r.repo, version, err)
 	}
 
 	log.Printf("Successfully created release: %s", rel.GetHTMLURL())
-	return nil
+	return rel.GetHTMLURL(), nil
 }
@@ -0,0 +1,758 @@
+package workflow_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/collectd/releaser/policy"
+	"github.com/collectd/releaser/workflow"
+	"github.com/collectd/releaser/workflow/fakegithub"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/github"
+)
+
+const (
+	owner  = "collectd"
+	repo   = "collectd"
+	branch = "collectd-6.0"
+)
+
+const initialChangeLog = "2024-01-01, Version 6.0.0\n\t* Initial release.\n"
+
+// newRepo returns a repository with the release 6.0.0 and three pull requests
+// merged since, one with each merge method.
+func newRepo(t *testing.T) *fakegithub.Repo {
+	t.Helper()
+
+	r := fakegithub.New(owner, repo)
+	r.Label("Breaking", "Feature", "Fix", "core")
+
+	r.Commit(branch, "Initial commit", map[string]string{
+		"ChangeLog": initialChangeLog,
+	})
+	r.AddRelease("collectd-6.0.0", "6.0.0", branch, false)
+
+	merge := func(n int, title, label, entry string, method fakegithub.MergeMethod) {
+		r.Merge(&github.PullRequest{
+			Number: github.Int(n),
+			Title:  github.String(title),
+			Body:   github.String("ChangeLog: " + entry),
+			User:   &github.User{Login: github.String("octo")},
+			Labels: []*github.Label{{Name: github.String(label)}},
+			Base:   &github.PullRequestBranch{Ref: github.String(branch)},
+		}, method, map[string]string{
+			"src/file.c": title,
+		})
+	}
+	merge(1, "Add the foo plugin", "Feature", "Foo plugin: New plugin.", fakegithub.MergeCommit)
+	merge(2, "Fix a crash in the bar plugin", "Fix", "Bar plugin: A crash has been fixed.", fakegithub.Squash)
+	merge(3, "Fix a leak in the daemon", "Fix", "collectd: A memory leak has been fixed.", fakegithub.Rebase)
+
+	r.Status(r.Head(branch), "ci/build", "success")
+	return r
+}
+
+func newReleaser(t *testing.T, r *fakegithub.Repo, modify func(*workflow.Options)) *workflow.Releaser {
+	t.Helper()
+
+	opts := workflow.Options{
+		Owner:         owner,
+		Repo:          repo,
+		Branch:        branch,
+		Client:        r.Client(),
+		Discovery:     "api",
+		StateDir:      t.TempDir(),
+		TagPrefix:     "collectd-",
+		MajorVersions: []int{6},
+	}
+	if modify != nil {
+		modify(&opts)
+	}
+	wf, err := workflow.New(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	head := r.Head(branch)
+
+	st, err := newReleaser(t, r, nil).Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Complete() {
+		t.Errorf("Run() = %+v, want completed state", st)
+	}
+	if diff := cmp.Diff([]int{3, 2, 1}, st.PullRequests); diff != "" {
+		t.Errorf("Run() pull requests differ (-want/+got):\n%s", diff)
+	}
+
+	newHead := r.Head(branch)
+	if newHead == head {
+		t.Fatal("Run() did not commit the ChangeLog")
+	}
+	if got, want := r.Message(newHead), "Update ChangeLog for version 6.1.0."; got != want {
+		t.Errorf("commit message = %q, want %q", got, want)
+	}
+
+	changeLog, _ := r.File(branch, "ChangeLog")
+	if !strings.HasSuffix(changeLog, "\n"+initialChangeLog) {
+		t.Errorf("ChangeLog does not end with the previous content:\n%s", changeLog)
+	}
+	for _, want := range []string{", Version 6.1.0\n", "Foo plugin: New plugin.", "Bar plugin: A crash has been fixed.", "collectd: A memory leak has been fixed."} {
+		if !strings.Contains(changeLog, want) {
+			t.Errorf("ChangeLog does not contain %q:\n%s", want, changeLog)
+		}
+	}
+
+	rels := r.Releases()
+	if len(rels) != 2 {
+		t.Fatalf("got %d releases, want 2", len(rels))
+	}
+	rel := rels[0]
+	if got, want := rel.GetTagName(), "collectd-6.1.0"; got != want {
+		t.Errorf("release tag = %q, want %q", got, want)
+	}
+	if rel.GetPrerelease() {
+		t.Errorf("release %q is a pre-release", rel.GetTagName())
+	}
+	if got := r.TagCommit("collectd-6.1.0"); got != newHead {
+		t.Errorf("tag points to %s, want the ChangeLog commit %s", got, newHead)
+	}
+	if !strings.Contains(rel.GetBody(), "Foo plugin: New plugin.") {
+		t.Errorf("release notes do not contain the ChangeLog entries:\n%s", rel.GetBody())
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	r := newRepo(t)
+	head := r.Head(branch)
+
+	if _, err := newReleaser(t, r, func(opts *workflow.Options) {
+		opts.DryRun = true
+	}).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := r.Head(branch); got != head {
+		t.Errorf("branch head moved from %s to %s in dry-run mode", head, got)
+	}
+	if got := len(r.Releases()); got != 1 {
+		t.Errorf("got %d releases, want 1", got)
+	}
+}
+
+func TestRunRefusesFailedChecks(t *testing.T) {
+	r := newRepo(t)
+	r.CheckRun(r.Head(branch), "unit tests", "completed", "failure")
+
+	_, err := newReleaser(t, r, nil).Run(context.Background())
+
+	var statusErr *workflow.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Run() = %v, want *StatusError", err)
+	}
+	if diff := cmp.Diff([]string{"unit tests"}, statusErr.Failed); diff != "" {
+		t.Errorf("failed checks differ (-want/+got):\n%s", diff)
+	}
+	if got := len(r.Releases()); got != 1 {
+		t.Errorf("got %d releases, want 1", got)
+	}
+}
+
+func TestRunNoChecks(t *testing.T) {
+	r := newRepo(t)
+	r.Commit(branch, "Pushed directly", map[string]string{"README": "moved"})
+
+	_, err := newReleaser(t, r, nil).Run(context.Background())
+
+	var statusErr *workflow.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Run() = %v, want *StatusError", err)
+	}
+	if len(statusErr.Pending) != 1 {
+		t.Errorf("pending checks = %q, want one", statusErr.Pending)
+	}
+	if got := len(r.Releases()); got != 1 {
+		t.Errorf("got %d releases, want 1", got)
+	}
+}
+
+func TestRunRerunCheck(t *testing.T) {
+	r := newRepo(t)
+	head := r.Head(branch)
+	r.CheckRun(head, "unit tests", "completed", "failure")
+	r.CheckRun(head, "unit tests", "completed", "success")
+
+	if _, err := newReleaser(t, r, nil).Run(context.Background()); err != nil {
+		t.Errorf("Run() = %v, want the re-run check to take precedence", err)
+	}
+
+	r = newRepo(t)
+	head = r.Head(branch)
+	r.CheckRun(head, "unit tests", "completed", "success")
+	r.CheckRun(head, "unit tests", "in_progress", "")
+
+	_, err := newReleaser(t, r, nil).Run(context.Background())
+	var statusErr *workflow.StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Run() = %v, want *StatusError", err)
+	}
+	if diff := cmp.Diff([]string{"unit tests"}, statusErr.Pending); diff != "" {
+		t.Errorf("pending checks differ (-want/+got):\n%s", diff)
+	}
+}
+
+func TestRunMissingLabel(t *testing.T) {
+	r := fakegithub.New(owner, repo)
+	r.Label("Feature", "Fix")
+
+	_, err := newReleaser(t, r, func(opts *workflow.Options) {
+		opts.Policy = policy.Default
+	}).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `"Breaking"`) {
+		t.Errorf("Run() = %v, want error about the missing label", err)
+	}
+}
+
+func TestRunMissingDefaultLabel(t *testing.T) {
+	r := fakegithub.New(owner, repo)
+	r.Label("Feature", "Fix")
+	r.Commit(branch, "Initial commit", map[string]string{
+		"ChangeLog": initialChangeLog,
+	})
+	r.AddRelease("collectd-6.0.0", "6.0.0", branch, false)
+	r.Status(r.Head(branch), "ci/build", "success")
+
+	// Labels of the built-in policy are optional.
+	st, err := newReleaser(t, r, nil).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() = %v, want success without the \"Breaking\" label", err)
+	}
+	if st != nil {
+		t.Errorf("Run() = %+v, want nothing to release", st)
+	}
+}
+
+func TestRunMissingChangeLog(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	r.UpdatePR(2, func(pr *github.PullRequest) {
+		pr.Body = github.String("Fixes a crash.")
+	})
+	r.UpdatePR(3, func(pr *github.PullRequest) {
+		pr.Body = github.String("ChangeLog: none")
+	})
+	head := r.Head(branch)
+
+	strict := func(opts *workflow.Options) {
+		opts.StrictChangeLog = true
+		opts.RemindChangeLog = true
+	}
+	for i := 0; i < 2; i++ {
+		_, err := newReleaser(t, r, strict).Run(ctx)
+		if err == nil || !strings.Contains(err.Error(), "#2") || strings.Contains(err.Error(), "#3") {
+			t.Errorf("Run() = %v, want error about #2", err)
+		}
+	}
+	if got := r.Head(branch); got != head {
+		t.Errorf("Run() in strict mode committed to the branch: %s", r.Message(got))
+	}
+	if got := len(r.Comments(2)); got != 1 {
+		t.Errorf("#2 has %d comments, want 1", got)
+	}
+	if got := len(r.Comments(3)); got != 0 {
+		t.Errorf("#3 has %d comments, want 0", got)
+	}
+
+	if _, err := newReleaser(t, r, nil).Run(ctx); err != nil {
+		t.Errorf("Run() = %v, want success without strict mode", err)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	stateDir := t.TempDir()
+	withState := func(opts *workflow.Options) {
+		opts.StateDir = stateDir
+	}
+
+	r.FailOnce("Repositories.CreateRelease", errors.New("connection reset"))
+	if _, err := newReleaser(t, r, withState).Run(ctx); err == nil {
+		t.Fatal("Run() succeeded, want error")
+	}
+	changeLogCommit := r.Head(branch)
+
+	st, err := newReleaser(t, r, withState).Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.Tag, "collectd-6.1.0"; got != want {
+		t.Errorf("Run() resumed %q, want %q", got, want)
+	}
+
+	if got := r.Head(branch); got != changeLogCommit {
+		t.Errorf("the resumed release committed to the branch again: %s", r.Message(got))
+	}
+	changeLog, _ := r.File(branch, "ChangeLog")
+	if n := strings.Count(changeLog, ", Version 6.1.0\n"); n != 1 {
+		t.Errorf("ChangeLog contains %d sections for 6.1.0, want 1:\n%s", n, changeLog)
+	}
+	if got := r.TagCommit("collectd-6.1.0"); got != changeLogCommit {
+		t.Errorf("tag points to %s, want %s", got, changeLogCommit)
+	}
+}
+
+func TestRunResumeMovedBranch(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	stateDir := t.TempDir()
+	withState := func(opts *workflow.Options) {
+		opts.StateDir = stateDir
+	}
+
+	r.FailOnce("Git.CreateCommit", errors.New("connection reset"))
+	if _, err := newReleaser(t, r, withState).Run(ctx); err == nil {
+		t.Fatal("Run() succeeded, want error")
+	}
+
+	head := r.Commit(branch, "Pushed directly", map[string]string{"README": "moved"})
+	r.Status(head, "ci/build", "success")
+
+	if _, err := newReleaser(t, r, withState).Run(ctx); err == nil || !strings.Contains(err.Error(), "has moved") {
+		t.Errorf("Run() = %v, want error about the moved branch", err)
+	}
+	if got := r.Head(branch); got != head {
+		t.Errorf("the resumed release committed to the moved branch: %s", r.Message(got))
+	}
+	if got := len(r.Releases()); got != 1 {
+		t.Errorf("got %d releases, want 1", got)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	wf := newReleaser(t, r, nil)
+
+	p, err := wf.Plan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.Version, "6.1.0"; got != want {
+		t.Errorf("Plan().Version = %q, want %q", got, want)
+	}
+	if got := len(r.Releases()); got != 1 {
+		t.Fatalf("Plan() created a release")
+	}
+
+	r.Commit(branch, "Pushed directly", map[string]string{"README": "moved"})
+	if err := wf.Apply(ctx, p); err == nil || !strings.Contains(err.Error(), "has moved") {
+		t.Errorf("Apply() = %v, want error about the moved branch", err)
+	}
+}
+
+func TestPlanApplyMissingChangeLog(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	r.UpdatePR(2, func(pr *github.PullRequest) {
+		pr.Body = github.String("Fixes a crash.")
+	})
+	head := r.Head(branch)
+
+	strict := func(opts *workflow.Options) {
+		opts.StrictChangeLog = true
+		opts.RemindChangeLog = true
+	}
+	p, err := newReleaser(t, r, strict).Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan() = %v, want success in strict mode", err)
+	}
+	if got := len(r.Comments(2)); got != 0 {
+		t.Errorf("Plan() commented on #2, want no side effects")
+	}
+	if diff := cmp.Diff([]int{2}, p.Remind); diff != "" {
+		t.Errorf("Plan().Remind differs (-want/+got):\n%s", diff)
+	}
+	if want := "Comment on #2 to ask for the missing ChangeLog entry."; !strings.Contains(p.String(), want) {
+		t.Errorf("Plan().String() does not contain %q:\n%s", want, p)
+	}
+
+	if err := newReleaser(t, r, strict).Apply(ctx, p); err == nil || !strings.Contains(err.Error(), "#2") {
+		t.Errorf("Apply() = %v, want error about #2", err)
+	}
+	if got := r.Head(branch); got != head {
+		t.Errorf("Apply() in strict mode committed to the branch: %s", r.Message(got))
+	}
+	if got := len(r.Comments(2)); got != 1 {
+		t.Errorf("#2 has %d comments, want 1", got)
+	}
+	if p, err := newReleaser(t, r, strict).Plan(ctx); err != nil {
+		t.Errorf("Plan() = %v", err)
+	} else if len(p.Remind) != 0 {
+		t.Errorf("Plan().Remind = %v after the reminder, want none", p.Remind)
+	}
+
+	if err := newReleaser(t, r, nil).Apply(ctx, p); err != nil {
+		t.Errorf("Apply() = %v, want success without strict mode", err)
+	}
+}
+
+func TestPlanBranchMerge(t *testing.T) {
+	const oldBranch = "collectd-5.12"
+
+	r := newRepo(t)
+	r.Branch(oldBranch, "collectd-6.0.0")
+	merge := func(n int, title string, method fakegithub.MergeMethod) {
+		r.Merge(&github.PullRequest{
+			Number: github.Int(n),
+			Title:  github.String(title),
+			Body:   github.String("ChangeLog: Baz plugin: " + title + "."),
+			User:   &github.User{Login: github.String("octo")},
+			Labels: []*github.Label{{Name: github.String("Fix")}},
+			Base:   &github.PullRequestBranch{Ref: github.String(oldBranch)},
+		}, method, map[string]string{
+			"src/baz.c": title,
+		})
+	}
+	merge(4, "Fix a crash", fakegithub.Squash)
+	merge(5, "Fix a leak", fakegithub.Rebase)
+	r.MergeBranch(oldBranch, branch)
+	r.Status(r.Head(branch), "ci/build", "success")
+
+	p, err := newReleaser(t, r, nil).Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int
+	for _, pr := range p.PullRequests {
+		got = append(got, pr.Number)
+	}
+	if diff := cmp.Diff([]int{5, 4, 3, 2, 1}, got); diff != "" {
+		t.Errorf("Plan() pull requests differ (-want/+got):\n%s", diff)
+	}
+}
+
+func TestPromote(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	wf := newReleaser(t, r, func(opts *workflow.Options) {
+		opts.PreRelease = "-rc"
+	})
+	merge := func(n int, title, path string) {
+		r.Merge(&github.PullRequest{
+			Number: github.Int(n),
+			Title:  github.String(title),
+			Body:   github.String("ChangeLog: Baz plugin: " + title + "."),
+			User:   &github.User{Login: github.String("octo")},
+			Labels: []*github.Label{{Name: github.String("Fix")}},
+			Base:   &github.PullRequestBranch{Ref: github.String(branch)},
+		}, fakegithub.Squash, map[string]string{
+			path: title,
+		})
+		r.Status(r.Head(branch), "ci/build", "success")
+	}
+
+	for i, want := range []string{"collectd-6.1.0-rc0", "collectd-6.1.0-rc1"} {
+		st, err := wf.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Tag; got != want {
+			t.Fatalf("Run() created %q, want %q", got, want)
+		}
+		merge(4+i, fmt.Sprintf("Fix bug %d", 4+i), "src/baz.c")
+	}
+	// The last change is not part of any release candidate.
+	rcCommit := r.TagCommit("collectd-6.1.0-rc1")
+
+	// The first attempt fails after the ChangeLog has been committed and is
+	// run again.
+	r.FailOnce("Repositories.CreateRelease", errors.New("internal server error"))
+	if err := wf.Promote(ctx, ""); err == nil {
+		t.Fatal("Promote() succeeded, want error")
+	}
+	if err := wf.Promote(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	rel := r.Releases()[0]
+	if got, want := rel.GetTagName(), "collectd-6.1.0"; got != want {
+		t.Errorf("release tag = %q, want %q", got, want)
+	}
+	if rel.GetPrerelease() {
+		t.Errorf("release %q is a pre-release", rel.GetTagName())
+	}
+	if !strings.Contains(rel.GetBody(), "Foo plugin: New plugin.") || strings.Contains(rel.GetBody(), "Fix bug 5") {
+		t.Errorf("release notes do not contain exactly the changes since 6.0.0:\n%s", rel.GetBody())
+	}
+
+	if got := r.TagCommit("collectd-6.1.0"); got != rcCommit {
+		t.Errorf("final tag points to %s, want the release candidate's commit %s", got, rcCommit)
+	}
+
+	head := r.Head(branch)
+	if got, want := r.Message(head), "Update ChangeLog for version 6.1.0."; got != want {
+		t.Errorf("branch head commit message = %q, want %q", got, want)
+	}
+	if got, _ := r.File(branch, "src/baz.c"); got != "Fix bug 5" {
+		t.Errorf("src/baz.c on the branch = %q, want the latest content", got)
+	}
+
+	changeLog, _ := r.File(branch, "ChangeLog")
+	if got := strings.Count(changeLog, ", Version 6.1.0\n"); got != 1 || strings.Contains(changeLog, "-rc") {
+		t.Errorf("ChangeLog has %d sections for 6.1.0, want one replacing the release candidates:\n%s", got, changeLog)
+	}
+	for _, want := range []string{"Foo plugin: New plugin.", "Baz plugin: Fix bug 4."} {
+		if !strings.Contains(changeLog, want) {
+			t.Errorf("ChangeLog does not contain %q:\n%s", want, changeLog)
+		}
+	}
+	if !strings.HasSuffix(changeLog, "\n"+initialChangeLog) {
+		t.Errorf("ChangeLog does not end with the previous content:\n%s", changeLog)
+	}
+	if strings.Contains(changeLog, "Fix bug 5") {
+		t.Errorf("ChangeLog lists a change made after the release candidate:\n%s", changeLog)
+	}
+}
+
+// TestRunReplay runs a release against GitHub API traffic recorded with
+// Options.RecordDir and checks that the requests still match the recording.
+func TestRunReplay(t *testing.T) {
+	ctx := context.Background()
+	wf, err := workflow.New(ctx, workflow.Options{
+		Owner:         owner,
+		Repo:          repo,
+		Branch:        branch,
+		Discovery:     "api",
+		StateDir:      t.TempDir(),
+		TagPrefix:     "collectd-",
+		MajorVersions: []int{6},
+		ReplayDir:     "testdata/replay",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := wf.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := st.Tag, "collectd-6.0.1"; got != want {
+		t.Errorf("Run() released %q, want %q", got, want)
+	}
+	if !st.Complete() {
+		t.Errorf("Run() did not complete all steps: %v", st.Done)
+	}
+	if unused := wf.UnusedInteractions(); len(unused) != 0 {
+		t.Errorf("recorded interactions have not been replayed:\n%s", strings.Join(unused, "\n"))
+	}
+}
+
+func TestPendingCache(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	for n := 4; n <= 40; n++ {
+		r.Merge(&github.PullRequest{
+			Number: github.Int(n),
+			Title:  github.String(fmt.Sprintf("Change %d", n)),
+			Base:   &github.PullRequestBranch{Ref: github.String(branch)},
+		}, fakegithub.Squash, nil)
+	}
+
+	cacheDir := t.TempDir()
+	pending := func() []*github.PullRequest {
+		t.Helper()
+
+		wf := newReleaser(t, r, func(opts *workflow.Options) {
+			opts.Concurrency = 4
+			opts.CacheDir = cacheDir
+		})
+		p, err := wf.Pending(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.PullRequests
+	}
+
+	prs := pending()
+	var got []int
+	for _, pr := range prs {
+		got = append(got, pr.GetNumber())
+	}
+	var want []int
+	for n := 40; n >= 1; n-- {
+		want = append(want, n)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("pull requests differ (-want/+got):\n%s", diff)
+	}
+	if got, want := r.Calls("PullRequests.Get"), 40; got != want {
+		t.Errorf("PullRequests.Get called %d times, want %d", got, want)
+	}
+
+	pending()
+	if got, want := r.Calls("PullRequests.Get"), 40; got != want {
+		t.Errorf("PullRequests.Get called %d times with a warm cache, want %d", got, want)
+	}
+
+	r.UpdatePR(7, func(pr *github.PullRequest) {
+		pr.Title = github.String("Updated title")
+	})
+	prs = pending()
+	if got, want := r.Calls("PullRequests.Get"), 41; got != want {
+		t.Errorf("PullRequests.Get called %d times after an update, want %d", got, want)
+	}
+	if got, want := prs[40-7].GetTitle(), "Updated title"; got != want {
+		t.Errorf("title of #7 = %q, want %q", got, want)
+	}
+}
+
+func TestPendingCacheCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	for n := 4; n <= 150; n++ {
+		r.Merge(&github.PullRequest{
+			Number: github.Int(n),
+			Title:  github.String(fmt.Sprintf("Change %d", n)),
+			Base:   &github.PullRequestBranch{Ref: github.String(branch)},
+		}, fakegithub.Squash, nil)
+	}
+
+	cacheDir := t.TempDir()
+	pending := func() []*github.PullRequest {
+		t.Helper()
+
+		wf := newReleaser(t, r, func(opts *workflow.Options) {
+			opts.CacheDir = cacheDir
+		})
+		p, err := wf.Pending(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.PullRequests
+	}
+
+	pending()
+	if got, want := r.Calls("PullRequests.List"), 0; got != want {
+		t.Errorf("PullRequests.List called %d times with a cold cache, want %d", got, want)
+	}
+
+	// Without a checkpoint, the listing goes back to the oldest cached
+	// pull request.
+	pending()
+	if got, want := r.Calls("PullRequests.List"), 2; got != want {
+		t.Errorf("PullRequests.List called %d times without a checkpoint, want %d", got, want)
+	}
+
+	pending()
+	if got, want := r.Calls("PullRequests.List"), 3; got != want {
+		t.Errorf("PullRequests.List called %d times with a checkpoint, want %d", got, want)
+	}
+
+	r.UpdatePR(7, func(pr *github.PullRequest) {
+		pr.Title = github.String("Updated title")
+	})
+	gets := r.Calls("PullRequests.Get")
+	prs := pending()
+	if got, want := r.Calls("PullRequests.List"), 4; got != want {
+		t.Errorf("PullRequests.List called %d times after an update, want %d", got, want)
+	}
+	if got, want := r.Calls("PullRequests.Get"), gets+1; got != want {
+		t.Errorf("PullRequests.Get called %d times after an update, want %d", got, want)
+	}
+	if got, want := prs[150-7].GetTitle(), "Updated title"; got != want {
+		t.Errorf("title of #7 = %q, want %q", got, want)
+	}
+}
+
+func TestPendingDefaultTagPrefix(t *testing.T) {
+	r := newRepo(t)
+	p, err := newReleaser(t, r, func(opts *workflow.Options) {
+		opts.TagPrefix = ""
+	}).Pending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.Release.GetTagName(), "collectd-6.0.0"; got != want {
+		t.Errorf("Pending().Release = %q, want %q", got, want)
+	}
+}
+
+func TestPendingFetchError(t *testing.T) {
+	r := newRepo(t)
+	r.FailOnce("PullRequests.Get", errors.New("connection reset"))
+
+	if _, err := newReleaser(t, r, nil).Pending(context.Background()); err == nil {
+		t.Error("Pending() succeeded, want error")
+	}
+}
+
+func TestPendingGraphQL(t *testing.T) {
+	ctx := context.Background()
+	r := newRepo(t)
+	for n := 4; n <= 150; n++ {
+		r.Merge(&github.PullRequest{
+			Number: github.Int(n),
+			Title:  github.String(fmt.Sprintf("Change %d", n)),
+			Body:   github.String(fmt.Sprintf("ChangeLog: Change %d.", n)),
+			User:   &github.User{Login: github.String("octo")},
+			Labels: []*github.Label{{Name: github.String("Fix")}},
+			Base:   &github.PullRequestBranch{Ref: github.String(branch)},
+		}, fakegithub.Squash, nil)
+	}
+
+	pending := func(fetcher string) []*github.PullRequest {
+		t.Helper()
+
+		p, err := newReleaser(t, r, func(opts *workflow.Options) {
+			opts.Fetcher = fetcher
+		}).Pending(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.PullRequests
+	}
+
+	want := pending("rest")
+	got := pending("graphql")
+
+	if got, want := r.Calls("GraphQL.Query"), 2; got != want {
+		t.Errorf("GraphQL.Query called %d times, want %d", got, want)
+	}
+	if got, want := r.Calls("PullRequests.Get"), 150; got != want {
+		t.Errorf("PullRequests.Get called %d times, want %d (by the REST fetcher only)", got, want)
+	}
+
+	// Compare the fields consumed by the changelog and version packages.
+	opts := cmp.Options{
+		cmp.Transformer("PullRequest", func(pr *github.PullRequest) map[string]any {
+			var labels []string
+			for _, l := range pr.Labels {
+				labels = append(labels, l.GetName())
+			}
+			return map[string]any{
+				"number":   pr.GetNumber(),
+				"title":    pr.GetTitle(),
+				"body":     pr.GetBody(),
+				"author":   pr.GetUser().GetLogin(),
+				"labels":   labels,
+				"mergedAt": pr.GetMergedAt(),
+				"base":     pr.GetBase().GetRef(),
+				"sha":      pr.GetMergeCommitSHA(),
+			}
+		}),
+	}
+	if diff := cmp.Diff(want, got, opts); diff != "" {
+		t.Errorf("pull requests fetched with GraphQL differ (-rest/+graphql):\n%s", diff)
+	}
+}